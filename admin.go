@@ -0,0 +1,203 @@
+package sybase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
+)
+
+// ConnectionInfo describes the server and login the plugin is connected as.
+type ConnectionInfo struct {
+	ServerName string `json:"server_name"`
+	Version    string `json:"version"`
+	Login      string `json:"login"`
+	Database   string `json:"database"`
+
+	Capabilities *Capabilities `json:"capabilities"`
+}
+
+// LoginInfo describes the login the plugin is connected as.
+type LoginInfo struct {
+	Login string   `json:"login"`
+	Roles []string `json:"roles"`
+}
+
+// ManagedLogin is a login created by the plugin, as found in syslogins.
+type ManagedLogin struct {
+	Name            string    `json:"name"`
+	DefaultDatabase string    `json:"default_database"`
+	Created         time.Time `json:"created"`
+	Locked          bool      `json:"locked"`
+
+	// CreatedSource is the syslogins column Created comes from, crdate or,
+	// before ASE 15.0, pwdate. pwdate moves on every password change.
+	CreatedSource string `json:"created_source"`
+}
+
+// Columns of syslogins the creation time of a login is read from.
+const (
+	createdSourceCrdate = "crdate"
+	createdSourcePwdate = "pwdate"
+)
+
+// CheckConnection verifies the connection and describes the server.
+func (m *SYBASE) CheckConnection(ctx context.Context) (*ConnectionInfo, error) {
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ConnectionInfo{}
+	if err := db.QueryRowContext(ctx, connectionInfoSQL).Scan(&info.ServerName, &info.Version, &info.Login, &info.Database); err != nil {
+		return nil, errwrap.Wrapf("could not query server information: {{err}}", err)
+	}
+
+	if info.Capabilities, err = m.Capabilities(ctx); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Whoami returns the login the plugin is connected as and its active roles.
+func (m *SYBASE) Whoami(ctx context.Context) (*LoginInfo, error) {
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles string
+	info := &LoginInfo{}
+	if err := db.QueryRowContext(ctx, whoamiSQL).Scan(&info.Login, &roles); err != nil {
+		return nil, errwrap.Wrapf("could not query login roles: {{err}}", err)
+	}
+	info.Roles = strings.Fields(roles)
+	return info, nil
+}
+
+// ListManagedLogins returns the logins whose names match the pattern used by
+// the username generator.
+func (m *SYBASE) ListManagedLogins(ctx context.Context) ([]ManagedLogin, error) {
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	caps, err := m.Capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// syslogins has no creation date before ASE 15.0, where the date of the
+	// last password change is the closest thing to it
+	createdColumn := createdSourceCrdate
+	if caps.VersionNumber < sysloginsCrdateVersion {
+		createdColumn = createdSourcePwdate
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(listManagedLoginsSQL, createdColumn))
+	if err != nil {
+		return nil, errwrap.Wrapf("could not list logins: {{err}}", err)
+	}
+	defer rows.Close()
+
+	var logins []ManagedLogin
+	for rows.Next() {
+		login := ManagedLogin{CreatedSource: createdColumn}
+		var status int
+		if err := rows.Scan(&login.Name, &login.DefaultDatabase, &login.Created, &status); err != nil {
+			return nil, errwrap.Wrapf("could not read login: {{err}}", err)
+		}
+		login.Locked = status&loginStatusLocked != 0
+		logins = append(logins, login)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errwrap.Wrapf("could not list logins: {{err}}", err)
+	}
+
+	return logins, nil
+}
+
+// RenderStatements renders the role and rotation statements with
+// placeholder values, split into the batches that would be sent to the
+// server, keyed by kind of statement.
+func (m *SYBASE) RenderStatements(statements dbplugin.Statements, rotation []string) (map[string][]string, error) {
+	statements = dbutil.StatementCompatibilityHelper(statements)
+
+	_, creation, err := parseRoleDocument(statements)
+	if err != nil {
+		return nil, err
+	}
+	statements.Creation = creation
+
+	vars, err := m.placeholderVars()
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := map[string][]string{}
+	for _, op := range []struct {
+		name       string
+		statements []string
+		vars       map[string]interface{}
+	}{
+		{"creation", statements.Creation, vars.creation},
+		{"renewal", statements.Renewal, vars.renewal},
+		{"revocation", statements.Revocation, vars.revocation},
+		{"rotation", rotation, vars.rotation},
+	} {
+		render := renderStatement
+		if op.name == "creation" {
+			render = creationRenderer(placeholderObjects)
+		}
+		for _, stmt := range op.statements {
+			r, err := render(stmt, op.vars)
+			if err != nil {
+				return nil, errwrap.Wrapf(op.name+" statement: {{err}}", err)
+			}
+			rendered[op.name] = append(rendered[op.name], splitStatements(r)...)
+		}
+	}
+
+	return rendered, nil
+}
+
+// DryRunRotateRootCredentials checks that the root credentials can be
+// rotated, and validates the rotation statements without executing them.
+func (m *SYBASE) DryRunRotateRootCredentials(ctx context.Context, statements []string) (*ValidationReport, error) {
+	if len(m.Username) == 0 || len(m.Password) == 0 {
+		return nil, errors.New("username and password are required to rotate")
+	}
+	if err := m.checkNoEmbeddedPassword(); err != nil {
+		return nil, err
+	}
+
+	caps, err := m.Capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.ValidateStatements(ctx, dbplugin.Statements{}, rotateStatementsOrDefault(statements, caps))
+}
+
+// sysloginsCrdateVersion is the first ASE version with syslogins.crdate.
+const sysloginsCrdateVersion = 15000
+
+// loginStatusLocked is the syslogins status bit set by sp_locklogin.
+const loginStatusLocked = 2
+
+const connectionInfoSQL = `SELECT isnull(@@servername, ''), @@version, suser_name(), db_name()`
+
+const whoamiSQL = `SELECT suser_name(), isnull(show_role(), '')`
+
+const listManagedLoginsSQL = `
+SELECT name, isnull(dbname, ''), %s, status
+FROM master.dbo.syslogins
+WHERE name LIKE 'v[_]%%'
+ORDER BY name
+`
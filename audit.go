@@ -0,0 +1,83 @@
+package sybase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+// defaultAuditOptions are the audit options enabled for each login when
+// audit_logins is set without audit_options.
+var defaultAuditOptions = []string{"all"}
+
+var auditOptionRegex = regexp.MustCompile(`^[a-z_]+$`)
+
+// fullnameLen is the length of syslogins.fullname.
+const fullnameLen = 30
+
+func validateAuditOptions(options []string) error {
+	for _, option := range options {
+		if !auditOptionRegex.MatchString(option) {
+			return fmt.Errorf("invalid audit option %q", option)
+		}
+	}
+	return nil
+}
+
+// auditOptions returns the audit options to enable for each login, or nil
+// if logins are not audited.
+func (c *SQLConnectionProducer) auditOptions() []string {
+	switch {
+	case !c.AuditLogins:
+		return nil
+	case len(c.AuditOptions) > 0:
+		return c.AuditOptions
+	default:
+		return defaultAuditOptions
+	}
+}
+
+// auditFullname tags the login with the Vault identity it was issued to, so
+// that rows in the audit trail can be traced back to it.
+func auditFullname(usernameConfig dbplugin.UsernameConfig) string {
+	fullname := fmt.Sprintf("vault:%s:%s", usernameConfig.RoleName, usernameConfig.DisplayName)
+	if len(fullname) > fullnameLen {
+		fullname = fullname[:fullnameLen]
+	}
+	return fullname
+}
+
+// enableAudit tags a newly created login and turns on its audit options.
+func (s *session) enableAudit(ctx context.Context, username string, options []string, fullname string) error {
+	login := quoteLiteral(username)
+
+	if err := s.execQuery(ctx, fmt.Sprintf(modifyFullnameSQL, login, quoteLiteral(fullname))); err != nil {
+		return errwrap.Wrapf("could not tag login: {{err}}", err)
+	}
+
+	for _, option := range options {
+		if err := s.execQuery(ctx, fmt.Sprintf(auditSQL, quoteLiteral(option), login, "on")); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("could not enable audit option %s: {{err}}", option), err)
+		}
+	}
+	log.Printf("Enabled audit options %v for login '%s'", options, username)
+	return nil
+}
+
+// disableAudit turns off the login's audit options.
+func (s *session) disableAudit(ctx context.Context, username string, options []string) error {
+	for _, option := range options {
+		if err := s.execQuery(ctx, fmt.Sprintf(auditSQL, quoteLiteral(option), quoteLiteral(username), "off")); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("could not disable audit option %s: {{err}}", option), err)
+		}
+	}
+	return nil
+}
+
+const modifyFullnameSQL = `EXEC master.dbo.sp_modifylogin %s, 'fullname', %s`
+
+const auditSQL = `EXEC master.dbo.sp_audit %s, %s, 'all', '%s'`
@@ -0,0 +1,46 @@
+package sybase
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+func TestAuditFullname(t *testing.T) {
+	fullname := auditFullname(dbplugin.UsernameConfig{DisplayName: "token", RoleName: "analysts"})
+	if fullname != "vault:analysts:token" {
+		t.Fatalf("unexpected fullname %q", fullname)
+	}
+
+	fullname = auditFullname(dbplugin.UsernameConfig{DisplayName: "oidc-someone@example.com", RoleName: "analysts"})
+	if len(fullname) != fullnameLen {
+		t.Fatalf("expected the fullname to be truncated to %d characters, got %q", fullnameLen, fullname)
+	}
+}
+
+func TestSQLConnectionProducer_AuditOptions(t *testing.T) {
+	c := &SQLConnectionProducer{}
+	if options := c.auditOptions(); options != nil {
+		t.Fatalf("expected no audit options, got %v", options)
+	}
+
+	c.AuditLogins = true
+	if options := c.auditOptions(); !reflect.DeepEqual(options, []string{"all"}) {
+		t.Fatalf("expected the default audit options, got %v", options)
+	}
+
+	c.AuditOptions = []string{"cmdtext"}
+	if options := c.auditOptions(); !reflect.DeepEqual(options, []string{"cmdtext"}) {
+		t.Fatalf("expected the configured audit options, got %v", options)
+	}
+
+	err := (&SQLConnectionProducer{}).configure(map[string]interface{}{
+		"connection_url": "Server=audit",
+		"audit_logins":   true,
+		"audit_options":  []string{"all', 'off"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for an invalid audit option")
+	}
+}
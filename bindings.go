@@ -0,0 +1,141 @@
+package sybase
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// predefinedExecClasses are the execution classes every server has.
+var predefinedExecClasses = []string{"EC1", "EC2", "EC3"}
+
+// defaultTempdbGroup is the tempdb group every server has.
+const defaultTempdbGroup = "default"
+
+// bindLogin binds a newly created login to the role's execution class and
+// tempdb group.
+func (s *session) bindLogin(ctx context.Context, role *roleDocument, username string) error {
+	if role.ExecClass != "" {
+		query := fmt.Sprintf(bindExecClassSQL, quoteLiteral(username), quoteLiteral(role.ExecClass))
+		if err := s.execQuery(ctx, query); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("could not bind to execution class %s: {{err}}", role.ExecClass), err)
+		}
+		log.Printf("Bound login '%s' to execution class %s", username, role.ExecClass)
+	}
+
+	if role.TempdbGroup != "" {
+		query := fmt.Sprintf(bindTempdbGroupSQL, quoteLiteral(username), quoteLiteral(role.TempdbGroup))
+		if err := s.execQuery(ctx, query); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("could not bind to tempdb group %s: {{err}}", role.TempdbGroup), err)
+		}
+		log.Printf("Bound login '%s' to tempdb group %s", username, role.TempdbGroup)
+	}
+	return nil
+}
+
+// checkBindings checks that the role's execution class and tempdb group
+// exist.
+func (m *SYBASE) checkBindings(ctx context.Context, role *roleDocument) error {
+	if role.ExecClass == "" && role.TempdbGroup == "" {
+		return nil
+	}
+
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	if role.ExecClass != "" {
+		if err := checkExecClass(ctx, db, role.ExecClass); err != nil {
+			return err
+		}
+	}
+	if role.TempdbGroup != "" {
+		if err := checkTempdbGroup(ctx, db, role.TempdbGroup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unbindLogin removes the login's execution class and tempdb group
+// bindings, if it has any.
+func (s *session) unbindLogin(ctx context.Context, username string) error {
+	login := quoteLiteral(username)
+	if err := s.execQuery(ctx, fmt.Sprintf(unbindExecClassSQL, login, login)); err != nil {
+		return errwrap.Wrapf("could not unbind execution class: {{err}}", err)
+	}
+	if err := s.execQuery(ctx, fmt.Sprintf(unbindTempdbGroupSQL, login, login)); err != nil {
+		return errwrap.Wrapf("could not unbind tempdb group: {{err}}", err)
+	}
+	return nil
+}
+
+// checkExecClass checks that the execution class exists.
+func checkExecClass(ctx context.Context, db *sql.DB, name string) error {
+	for _, class := range predefinedExecClasses {
+		if strings.EqualFold(name, class) {
+			return nil
+		}
+	}
+	return checkExists(ctx, db, execClassExistsSQL, "execution class", name)
+}
+
+// checkTempdbGroup checks that the tempdb group exists.
+func checkTempdbGroup(ctx context.Context, db *sql.DB, name string) error {
+	if name == defaultTempdbGroup {
+		return nil
+	}
+	return checkExists(ctx, db, tempdbGroupExistsSQL, "tempdb group", name)
+}
+
+// queryer is what the existence checks need of a *sql.DB or *sql.Conn.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// checkExists runs a query counting the objects of the kind with the name.
+func checkExists(ctx context.Context, q queryer, query, kind, name string) error {
+	var count int
+	if err := q.QueryRowContext(ctx, fmt.Sprintf(query, quoteLiteral(name))).Scan(&count); err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("could not check %s: {{err}}", kind), newServerError(err))
+	}
+	if count == 0 {
+		return fmt.Errorf("%s %q does not exist", kind, name)
+	}
+	return nil
+}
+
+const bindExecClassSQL = `EXEC master.dbo.sp_bindexeclass %s, 'LG', NULL, %s`
+
+const bindTempdbGroupSQL = `EXEC master.dbo.sp_tempdb 'bind', 'lg', %s, 'GR', %s`
+
+// Execution class definitions and bindings are class 6 attributes, tempdb
+// groups and bindings class 16.
+const unbindExecClassSQL = `
+IF EXISTS
+  (SELECT object_cinfo
+   FROM master.dbo.sysattributes
+   WHERE class = 6 AND object_type = 'LG' AND object_cinfo = %s)
+BEGIN
+  EXEC master.dbo.sp_unbindexeclass %s, 'LG', NULL
+END
+`
+
+const unbindTempdbGroupSQL = `
+IF EXISTS
+  (SELECT object_cinfo
+   FROM master.dbo.sysattributes
+   WHERE class = 16 AND object_type = 'LG' AND object_cinfo = %s)
+BEGIN
+  EXEC master.dbo.sp_tempdb 'unbind', 'lg', %s
+END
+`
+
+const execClassExistsSQL = `SELECT count(*) FROM master.dbo.sysattributes WHERE class = 6 AND object_type = 'EC' AND object_cinfo = %s`
+
+const tempdbGroupExistsSQL = `SELECT count(*) FROM master.dbo.sysattributes WHERE class = 16 AND object_type = 'GR' AND object_cinfo = %s`
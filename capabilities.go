@@ -0,0 +1,176 @@
+package sybase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// SQL dialects for the plugin's default statements.
+const (
+	dialectAuto   = "auto"
+	dialectModern = "modern"
+	dialectLegacy = "legacy"
+)
+
+// modernLoginDDLVersion is the first ASE version, as in @@version_number,
+// with CREATE LOGIN, ALTER LOGIN and DROP LOGIN.
+const modernLoginDDLVersion = 15700
+
+// serverFeatures are the configuration parameters recorded in the capability
+// profile. The features the plugin relies on are checked against these.
+var serverFeatures = []string{
+	"allow resource limits",
+	"auditing",
+	"enable granular permissions",
+	"enable login profiles",
+}
+
+var versionRegex = regexp.MustCompile(`Adaptive Server Enterprise/(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// Capabilities is the profile of the server detected at Init.
+type Capabilities struct {
+	Version       string         `json:"version"`
+	VersionNumber int            `json:"version_number"`
+	Dialect       string         `json:"dialect"`
+	Features      map[string]int `json:"features"`
+}
+
+// modern reports whether the plugin should use the CREATE/ALTER/DROP LOGIN
+// syntax rather than the sp_addlogin family of procedures.
+func (c *Capabilities) modern() bool {
+	return c.Dialect == dialectModern
+}
+
+// Capabilities returns the capability profile of the server, detecting it
+// first if that has not happened yet.
+func (m *SYBASE) Capabilities(ctx context.Context) (*Capabilities, error) {
+	m.capabilitiesLock.Lock()
+	defer m.capabilitiesLock.Unlock()
+
+	if m.capabilities != nil {
+		return m.capabilities, nil
+	}
+
+	caps, err := m.detectCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.capabilities = caps
+	return caps, nil
+}
+
+// setCapabilities replaces the detected profile along with the
+// configuration, nil to have it detected again when it is next needed.
+func (m *SYBASE) setCapabilities(caps *Capabilities) {
+	m.capabilitiesLock.Lock()
+	defer m.capabilitiesLock.Unlock()
+
+	m.capabilities = caps
+}
+
+func (m *SYBASE) detectCapabilities(ctx context.Context) (*Capabilities, error) {
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	caps := &Capabilities{
+		Features: map[string]int{},
+	}
+	if err := db.QueryRowContext(ctx, versionSQL).Scan(&caps.Version); err != nil {
+		return nil, errwrap.Wrapf("could not query server version: {{err}}", err)
+	}
+
+	// @@version_number only exists from ASE 15.0.2 on
+	if err := db.QueryRowContext(ctx, versionNumberSQL).Scan(&caps.VersionNumber); err != nil {
+		if caps.VersionNumber, err = parseVersionNumber(caps.Version); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(featuresSQL, quotedList(serverFeatures)))
+	if err != nil {
+		return nil, errwrap.Wrapf("could not query server configuration: {{err}}", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var value int
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, errwrap.Wrapf("could not read server configuration: {{err}}", err)
+		}
+		caps.Features[name] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errwrap.Wrapf("could not query server configuration: {{err}}", err)
+	}
+
+	switch m.Dialect {
+	case dialectModern, dialectLegacy:
+		caps.Dialect = m.Dialect
+	default:
+		caps.Dialect = dialectLegacy
+		if caps.VersionNumber >= modernLoginDDLVersion {
+			caps.Dialect = dialectModern
+		}
+	}
+
+	log.Printf("Detected ASE version %d, using the %s dialect", caps.VersionNumber, caps.Dialect)
+	return caps, nil
+}
+
+// parseVersionNumber converts the version in an @@version string to the
+// form of @@version_number, for example 12.5.4 to 12540.
+func parseVersionNumber(version string) (int, error) {
+	match := versionRegex.FindStringSubmatch(version)
+	if match == nil {
+		return 0, fmt.Errorf("could not parse server version %q", version)
+	}
+
+	var number int
+	for i, weight := range []int{1000, 100, 10} {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("could not parse server version %q", version)
+		}
+		number += n * weight
+	}
+	return number, nil
+}
+
+func validateDialect(dialect string) error {
+	switch dialect {
+	case "", dialectAuto, dialectModern, dialectLegacy:
+		return nil
+	default:
+		return fmt.Errorf("invalid dialect %q, must be one of %q, %q or %q", dialect, dialectAuto, dialectModern, dialectLegacy)
+	}
+}
+
+func quotedList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = string(quoteLiteral(v))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+const versionSQL = `SELECT @@version`
+
+const versionNumberSQL = `SELECT @@version_number`
+
+const featuresSQL = `
+SELECT c.comment, cc.value
+FROM master.dbo.sysconfigures c, master.dbo.syscurconfigs cc
+WHERE c.config = cc.config
+AND c.comment IN (%s)
+`
@@ -0,0 +1,42 @@
+package sybase
+
+import (
+	"testing"
+)
+
+func TestParseVersionNumber(t *testing.T) {
+	tests := map[string]int{
+		"Adaptive Server Enterprise/12.5.4/EBF 15432 ESD#8/P/Sun_svr4/OS 5.8/ase1254/2105/64-bit/FBO/Sat Mar 22 14:38:37 2008": 12540,
+		"Adaptive Server Enterprise/15.0.3/EBF 16738 ESD#2/P/Linux Intel/Linux 2.4.21-47.ELsmp i686/ase1503/2708/32-bit/FBO":   15030,
+		"Adaptive Server Enterprise/16.0 SP03 PL02/EBF 27413 SMP/P/x86_64/SLES 11.1/ase160sp03pl02x/3096/64-bit/FBO":           16000,
+	}
+
+	for version, expected := range tests {
+		actual, err := parseVersionNumber(version)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != expected {
+			t.Fatalf("expected %d for %q, got %d", expected, version, actual)
+		}
+	}
+
+	if _, err := parseVersionNumber("Microsoft SQL Server 2017"); err == nil {
+		t.Fatal("expected error for an unknown version string")
+	}
+}
+
+func TestRotateStatementsOrDefault(t *testing.T) {
+	modern := &Capabilities{Dialect: dialectModern}
+	legacy := &Capabilities{Dialect: dialectLegacy}
+
+	if s := rotateStatementsOrDefault(nil, modern); s[0] != rotateRootCredentialsSQL {
+		t.Fatalf("unexpected modern default: %q", s)
+	}
+	if s := rotateStatementsOrDefault(nil, legacy); s[0] != rotateRootCredentialsLegacySQL {
+		t.Fatalf("unexpected legacy default: %q", s)
+	}
+	if s := rotateStatementsOrDefault([]string{"custom"}, legacy); s[0] != "custom" {
+		t.Fatalf("expected the given statements, got %q", s)
+	}
+}
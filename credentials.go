@@ -0,0 +1,100 @@
+package sybase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Connection string keys FreeTDS accepts for the login name and password.
+var (
+	connUserKeys     = []string{"user id", "user_id", "user", "uid", "username"}
+	connPasswordKeys = []string{"password", "pwd", "passwd"}
+)
+
+// splitEmbeddedCredentials replaces a literal login name and password in a
+// connection string of the form "key=value;key=value" with {{username}} and
+// {{password}}, returning the values it replaced. A value that is already a
+// template is left alone.
+func splitEmbeddedCredentials(connURL string) (templated, username, password string) {
+	parts := strings.Split(connURL, ";")
+	for i, part := range parts {
+		eq := strings.Index(part, "=")
+		if eq < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(part[:eq]))
+		value := strings.TrimSpace(part[eq+1:])
+		if value == "" || strings.Contains(value, "{{") {
+			continue
+		}
+
+		switch {
+		case containsString(connUserKeys, key):
+			username = value
+			parts[i] = part[:eq+1] + "{{username}}"
+		case containsString(connPasswordKeys, key):
+			password = value
+			parts[i] = part[:eq+1] + "{{password}}"
+		}
+	}
+	return strings.Join(parts, ";"), username, password
+}
+
+// migrateEmbeddedCredentials moves credentials embedded in connection_url to
+// the username and password parameters, so that rotating the password
+// updates the only copy of it. The migrated configuration replaces RawConfig,
+// which Init returns for Vault to save; the map passed to Init is not
+// modified.
+func (c *SQLConnectionProducer) migrateEmbeddedCredentials() error {
+	templated, username, password := splitEmbeddedCredentials(c.ConnectionURL)
+	if username == "" && password == "" {
+		return nil
+	}
+
+	migrated := make(map[string]interface{}, len(c.RawConfig)+2)
+	for k, v := range c.RawConfig {
+		migrated[k] = v
+	}
+
+	if username != "" {
+		if c.Username != "" && c.Username != username {
+			return fmt.Errorf("connection_url embeds the login %q but username is %q", username, c.Username)
+		}
+		c.Username = username
+		migrated["username"] = username
+	}
+	if password != "" {
+		if c.Password != "" && c.Password != password {
+			return errors.New("connection_url embeds a password that differs from the password parameter")
+		}
+		c.Password = password
+		migrated["password"] = password
+	}
+
+	c.ConnectionURL = templated
+	migrated["connection_url"] = templated
+	c.RawConfig = migrated
+	log.Println("Moved the credentials embedded in connection_url to the username and password parameters")
+	return nil
+}
+
+// checkNoEmbeddedPassword fails if the saved connection_url still contains
+// the password, which rotation could not update.
+func (c *SQLConnectionProducer) checkNoEmbeddedPassword() error {
+	connURL, _ := c.RawConfig["connection_url"].(string)
+	if _, _, password := splitEmbeddedCredentials(connURL); password != "" {
+		return errors.New("connection_url contains the password, which rotation cannot update; replace it with {{password}} and set the password parameter before rotating")
+	}
+	return nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package sybase
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSplitEmbeddedCredentials(t *testing.T) {
+	templated, username, password := splitEmbeddedCredentials("Server=ase; User Id=sa;Password=s3cret; Database=master")
+	if templated != "Server=ase; User Id={{username}};Password={{password}}; Database=master" {
+		t.Fatalf("unexpected connection string: %s", templated)
+	}
+	if username != "sa" || password != "s3cret" {
+		t.Fatalf("unexpected credentials: %q, %q", username, password)
+	}
+
+	templated, username, password = splitEmbeddedCredentials("Server=ase;user={{username}};pwd={{password}}")
+	if templated != "Server=ase;user={{username}};pwd={{password}}" || username != "" || password != "" {
+		t.Fatalf("expected templated credentials to be left alone: %s, %q, %q", templated, username, password)
+	}
+}
+
+func TestSQLConnectionProducer_MigratesEmbeddedCredentials(t *testing.T) {
+	c := &SQLConnectionProducer{}
+	conf := map[string]interface{}{
+		"connection_url": "Server=ase;User Id=sa;Password=s3cret",
+	}
+	saved, err := c.Init(context.Background(), conf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved["connection_url"] != "Server=ase;User Id={{username}};Password={{password}}" {
+		t.Fatalf("unexpected connection_url: %v", saved["connection_url"])
+	}
+	if saved["username"] != "sa" || saved["password"] != "s3cret" {
+		t.Fatalf("unexpected credentials: %v", saved)
+	}
+	if len(conf) != 1 || conf["connection_url"] != "Server=ase;User Id=sa;Password=s3cret" {
+		t.Fatalf("expected the caller's configuration to be left alone, got %v", conf)
+	}
+	if c.ConnectionURL != "Server=ase;User Id=sa;Password=s3cret" {
+		t.Fatalf("unexpected rendered connection string: %s", c.ConnectionURL)
+	}
+	if err := c.checkNoEmbeddedPassword(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = &SQLConnectionProducer{}
+	_, err = c.Init(context.Background(), map[string]interface{}{
+		"connection_url": "Server=ase;User Id=sa;Password=s3cret",
+		"username":       "vault",
+	}, false)
+	if err == nil {
+		t.Fatal("expected an error for conflicting usernames")
+	}
+
+	c = &SQLConnectionProducer{RawConfig: map[string]interface{}{
+		"connection_url": "Server=ase;Password=s3cret",
+	}}
+	if err := c.checkNoEmbeddedPassword(); err == nil {
+		t.Fatal("expected rotation to be refused")
+	}
+}
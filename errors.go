@@ -0,0 +1,186 @@
+package sybase
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	messageHeaderRegex = regexp.MustCompile(`^Msg (\d+), Level (\d+)(?:, State (\d+))?`)
+	messageOriginRegex = regexp.MustCompile(`^Server '([^']*)',\s*(?:Procedure '([^']*)',\s*)?(?:Line (\d+))?`)
+)
+
+// redacted replaces secret values in errors.
+const redacted = "[redacted]"
+
+// ServerMessage is a single message reported by ASE or DB-Library along
+// with an error. DB-Library messages have no state or origin.
+type ServerMessage struct {
+	Number    int    `json:"number"`
+	Severity  int    `json:"severity"`
+	State     int    `json:"state,omitempty"`
+	Server    string `json:"server,omitempty"`
+	Procedure string `json:"procedure,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Text      string `json:"text"`
+}
+
+func (m ServerMessage) String() string {
+	s := fmt.Sprintf("Msg %d, Level %d", m.Number, m.Severity)
+	if m.State != 0 {
+		s += fmt.Sprintf(", State %d", m.State)
+	}
+	if m.Procedure != "" {
+		s += fmt.Sprintf(", Procedure '%s'", m.Procedure)
+	}
+	if m.Line != 0 {
+		s += fmt.Sprintf(", Line %d", m.Line)
+	}
+	return s + ": " + m.Text
+}
+
+// ServerError is an error returned by the driver, broken down into the
+// messages that came with it.
+type ServerError struct {
+	// Summary is the driver's own description of the failure, if any.
+	Summary  string          `json:"summary,omitempty"`
+	Messages []ServerMessage `json:"messages"`
+}
+
+func (e *ServerError) Error() string {
+	lines := make([]string, 0, len(e.Messages)+1)
+	if e.Summary != "" {
+		lines = append(lines, e.Summary)
+	}
+	for _, m := range e.Messages {
+		lines = append(lines, m.String())
+	}
+	return "ASE rejected the statement:\n" + strings.Join(lines, "\n")
+}
+
+// redact replaces every occurrence of the secrets in the error.
+func (e *ServerError) redact(secrets []string) {
+	e.Summary = redactSecrets(e.Summary, secrets)
+	for i := range e.Messages {
+		e.Messages[i].Text = redactSecrets(e.Messages[i].Text, secrets)
+	}
+}
+
+// newServerError parses the messages the driver puts in its error text. An
+// error without any messages is returned as it is.
+func newServerError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*ServerError); ok {
+		return err
+	}
+
+	serverErr := parseServerMessages(err.Error())
+	if len(serverErr.Messages) == 0 {
+		return err
+	}
+	return serverErr
+}
+
+// redactError removes the secrets from err, parsing it into a ServerError
+// first if it carries server messages.
+func redactError(err error, secrets []string) error {
+	if err == nil || len(secrets) == 0 {
+		return err
+	}
+
+	err = newServerError(err)
+	if serverErr, ok := err.(*ServerError); ok {
+		serverErr.redact(secrets)
+		return serverErr
+	}
+
+	if text := redactSecrets(err.Error(), secrets); text != err.Error() {
+		return fmt.Errorf("%s", text)
+	}
+	return err
+}
+
+// parseServerMessages parses messages in the format of the driver's message
+// and error handlers:
+//
+//	Msg 17231, Level 16, State 1
+//	Server 'ASE', Procedure 'sp_adduser', Line 32
+//		No login with the specified name exists.
+//
+// Lines outside of a message make up the summary.
+func parseServerMessages(text string) *ServerError {
+	serverErr := &ServerError{}
+	var summary []string
+	var current *ServerMessage
+
+	finish := func() {
+		if current != nil {
+			current.Text = strings.TrimSpace(current.Text)
+			serverErr.Messages = append(serverErr.Messages, *current)
+			current = nil
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if match := messageHeaderRegex.FindStringSubmatch(trimmed); match != nil {
+			finish()
+			current = &ServerMessage{}
+			current.Number, _ = strconv.Atoi(match[1])
+			current.Severity, _ = strconv.Atoi(match[2])
+			current.State, _ = strconv.Atoi(match[3])
+			continue
+		}
+
+		switch {
+		case current == nil:
+			if trimmed != "" {
+				summary = append(summary, trimmed)
+			}
+		case trimmed == "":
+			// A blank line ends the message's text
+			if current.Text != "" {
+				finish()
+			}
+		case current.Text == "" && current.Server == "" && messageOriginRegex.MatchString(trimmed):
+			match := messageOriginRegex.FindStringSubmatch(trimmed)
+			current.Server = match[1]
+			current.Procedure = match[2]
+			current.Line, _ = strconv.Atoi(match[3])
+		default:
+			if current.Text != "" {
+				current.Text += " "
+			}
+			current.Text += trimmed
+		}
+	}
+	finish()
+
+	serverErr.Summary = strings.Join(summary, " ")
+	return serverErr
+}
+
+// secretValues returns the values of the variables that hold passwords.
+func secretValues(vars map[string]interface{}) []string {
+	var secrets []string
+	for _, name := range []string{"password", "old_password"} {
+		if s, ok := vars[name].(string); ok && s != "" {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets
+}
+
+func redactSecrets(text string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.Replace(text, secret, redacted, -1)
+		}
+	}
+	return text
+}
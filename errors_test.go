@@ -0,0 +1,78 @@
+package sybase
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const driverErrorText = `Msg 20018, Level 16
+General SQL Server error: Check messages from the SQL Server
+
+
+Msg 17231, Level 16, State 1
+Server 'ASE', Procedure 'sp_adduser', Line 32
+	No login with the specified name exists.
+
+Msg 102, Level 15, State 1
+Server 'ASE', Line 1
+	Incorrect syntax near 's3cret'.
+`
+
+func TestNewServerError(t *testing.T) {
+	err := newServerError(errors.New("dbsqlexec failed\n" + driverErrorText))
+	serverErr, ok := err.(*ServerError)
+	if !ok {
+		t.Fatalf("expected a *ServerError, got %T", err)
+	}
+
+	if serverErr.Summary != "dbsqlexec failed" {
+		t.Fatalf("unexpected summary: %q", serverErr.Summary)
+	}
+	if len(serverErr.Messages) != 3 {
+		t.Fatalf("expected 3 messages, got %#v", serverErr.Messages)
+	}
+
+	expected := ServerMessage{
+		Number:    17231,
+		Severity:  16,
+		State:     1,
+		Server:    "ASE",
+		Procedure: "sp_adduser",
+		Line:      32,
+		Text:      "No login with the specified name exists.",
+	}
+	if serverErr.Messages[1] != expected {
+		t.Fatalf("unexpected message: %#v", serverErr.Messages[1])
+	}
+	if m := serverErr.Messages[0]; m.Number != 20018 || m.State != 0 || m.Text != "General SQL Server error: Check messages from the SQL Server" {
+		t.Fatalf("unexpected DB-Library message: %#v", m)
+	}
+
+	if !strings.Contains(err.Error(), "Msg 17231, Level 16, State 1, Procedure 'sp_adduser', Line 32: No login with the specified name exists.") {
+		t.Fatalf("unexpected error string: %s", err)
+	}
+
+	plain := errors.New("sql: database is closed")
+	if newServerError(plain) != plain {
+		t.Fatal("expected an error without messages to be returned as it is")
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	err := redactError(errors.New(driverErrorText), secretValues(map[string]interface{}{
+		"name":     "v_root_test",
+		"password": "s3cret",
+	}))
+	if strings.Contains(err.Error(), "s3cret") {
+		t.Fatalf("expected the password to be redacted: %s", err)
+	}
+	if !strings.Contains(err.Error(), "Incorrect syntax near '[redacted]'.") {
+		t.Fatalf("unexpected error string: %s", err)
+	}
+
+	err = redactError(errors.New("login failed for s3cret"), []string{"s3cret"})
+	if err.Error() != "login failed for [redacted]" {
+		t.Fatalf("unexpected error string: %s", err)
+	}
+}
@@ -0,0 +1,181 @@
+package sybase
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// defaultPasswordExpiryWarningDays is how many days before the root
+// password expires the plugin starts warning, unless
+// password_expiry_warning_days says otherwise.
+const defaultPasswordExpiryWarningDays = 14
+
+// passwordExpiryCheckInterval is how often operations check the root
+// password's expiry again after Init.
+const passwordExpiryCheckInterval = time.Hour
+
+// Where the expiration interval of a password comes from, in order of
+// precedence.
+const (
+	expirySourceLogin   = "login"
+	expirySourceProfile = "login profile"
+	expirySourceServer  = "systemwide password expiration"
+)
+
+// PasswordExpiry describes when the password of the configured login
+// expires.
+type PasswordExpiry struct {
+	Login        string    `json:"login"`
+	PasswordDate time.Time `json:"password_date"`
+
+	// IntervalDays is the number of days a password is valid for, 0 if it
+	// never expires, and Source where that interval is set.
+	IntervalDays int    `json:"interval_days"`
+	Source       string `json:"source,omitempty"`
+
+	// Expires and DaysUntilExpiry are only set if the password expires.
+	// DaysUntilExpiry is negative once it has expired.
+	Expires         *time.Time `json:"expires,omitempty"`
+	DaysUntilExpiry *int       `json:"days_until_expiry,omitempty"`
+
+	// Warning is set when the password expires within the warning
+	// threshold, or has expired.
+	Warning bool `json:"warning"`
+}
+
+// newPasswordExpiry works out the expiry of a password set at pwdate from
+// the intervals set on the login, its login profile and the server. A login
+// or profile setting overrides the ones after it, even when it is 0.
+func newPasswordExpiry(login string, pwdate time.Time, intervals [3]sql.NullInt64, now time.Time, warningDays int) *PasswordExpiry {
+	expiry := &PasswordExpiry{
+		Login:        login,
+		PasswordDate: pwdate,
+	}
+	for i, source := range []string{expirySourceLogin, expirySourceProfile, expirySourceServer} {
+		if intervals[i].Valid {
+			expiry.IntervalDays = int(intervals[i].Int64)
+			expiry.Source = source
+			break
+		}
+	}
+	if expiry.IntervalDays <= 0 {
+		expiry.IntervalDays = 0
+		return expiry
+	}
+
+	expires := pwdate.AddDate(0, 0, expiry.IntervalDays)
+	days := int(math.Floor(expires.Sub(now).Hours() / 24))
+	expiry.Expires = &expires
+	expiry.DaysUntilExpiry = &days
+	expiry.Warning = days < warningDays
+	return expiry
+}
+
+func (e *PasswordExpiry) String() string {
+	switch {
+	case e.Expires == nil:
+		return fmt.Sprintf("the password of login '%s' does not expire", e.Login)
+	case *e.DaysUntilExpiry < 0:
+		return fmt.Sprintf("the password of login '%s' expired on %s", e.Login, e.Expires.Format("2006-01-02"))
+	default:
+		return fmt.Sprintf("the password of login '%s' expires in %d days, on %s, after %d days set by %s", e.Login, *e.DaysUntilExpiry, e.Expires.Format("2006-01-02"), e.IntervalDays, e.Source)
+	}
+}
+
+// RootPasswordExpiry reads the password date of the configured login from
+// syslogins and works out when it expires.
+func (m *SYBASE) RootPasswordExpiry(ctx context.Context) (*PasswordExpiry, error) {
+	caps, err := m.Capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Login profiles, and syslogins.lpid, only exist from ASE 15.7 on
+	profileInterval := "NULL"
+	if caps.VersionNumber >= loginProfileVersion {
+		profileInterval = profilePasswordExpirySQL
+	}
+
+	var login string
+	var pwdate time.Time
+	var intervals [3]sql.NullInt64
+	err = db.QueryRowContext(ctx, fmt.Sprintf(passwordExpirySQL, profileInterval)).Scan(&login, &pwdate, &intervals[0], &intervals[1], &intervals[2])
+	if err != nil {
+		return nil, errwrap.Wrapf("could not query password expiration: {{err}}", newServerError(err))
+	}
+
+	warningDays := m.PasswordExpiryWarningDays
+	if warningDays == 0 {
+		warningDays = defaultPasswordExpiryWarningDays
+	}
+	return newPasswordExpiry(login, pwdate, intervals, time.Now(), warningDays), nil
+}
+
+// checkRootPasswordExpiry logs when the root password expires, warning if
+// that is within the threshold. Unless
+// forced, it does nothing if the last check was less than
+// passwordExpiryCheckInterval ago. The caller must hold the lock.
+func (m *SYBASE) checkRootPasswordExpiry(ctx context.Context, force bool) {
+	m.expiryLock.Lock()
+	due := force || time.Since(m.expiryCheckedAt) >= passwordExpiryCheckInterval
+	if due {
+		m.expiryCheckedAt = time.Now()
+	}
+	m.expiryLock.Unlock()
+	if !due {
+		return
+	}
+
+	expiry, err := m.RootPasswordExpiry(ctx)
+	if err != nil {
+		log.Printf("Warning: could not check the expiry of the root password: %s", err)
+		return
+	}
+
+	if expiry.Warning {
+		log.Printf("Warning: %s; rotate it with the rotate-root endpoint", expiry)
+		return
+	}
+	log.Printf("Checked the root password: %s", expiry)
+}
+
+// validatePasswordExpiryWarningDays checks the password_expiry_warning_days
+// parameter.
+func validatePasswordExpiryWarningDays(days int) error {
+	if days < 0 {
+		return fmt.Errorf("password_expiry_warning_days cannot be negative")
+	}
+	return nil
+}
+
+// passwordExpirySQL reads the configured login's password date and the
+// password expiration intervals that may apply to it, each NULL when not
+// set: the login's own and its profile's, both class 35 attribute 0 in
+// sysattributes, and the server's.
+const passwordExpirySQL = `
+SELECT l.name, l.pwdate,
+  (SELECT a.int_value
+   FROM master.dbo.sysattributes a
+   WHERE a.class = 35 AND a.attribute = 0 AND a.object = l.suid),
+  %s,
+  (SELECT cc.value
+   FROM master.dbo.sysconfigures c, master.dbo.syscurconfigs cc
+   WHERE c.config = cc.config AND c.comment = 'systemwide password expiration')
+FROM master.dbo.syslogins l
+WHERE l.suid = suser_id()
+`
+
+const profilePasswordExpirySQL = `(SELECT a.int_value
+   FROM master.dbo.sysattributes a
+   WHERE a.class = 35 AND a.attribute = 0 AND a.object = l.lpid)`
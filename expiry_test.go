@@ -0,0 +1,40 @@
+package sybase
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestNewPasswordExpiry(t *testing.T) {
+	now := time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)
+	interval := func(days int64) sql.NullInt64 {
+		return sql.NullInt64{Int64: days, Valid: true}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		pwdate    time.Time
+		intervals [3]sql.NullInt64
+		source    string
+		days      int
+		expires   bool
+		warning   bool
+	}{
+		{"never", now.AddDate(-1, 0, 0), [3]sql.NullInt64{{}, {}, interval(0)}, expirySourceServer, 0, false, false},
+		{"server", now.AddDate(0, 0, -30), [3]sql.NullInt64{{}, {}, interval(90)}, expirySourceServer, 60, true, false},
+		{"profile", now.AddDate(0, 0, -30), [3]sql.NullInt64{{}, interval(40), interval(90)}, expirySourceProfile, 10, true, true},
+		{"login", now.AddDate(0, 0, -30), [3]sql.NullInt64{interval(0), interval(40), interval(90)}, expirySourceLogin, 0, false, false},
+		{"expired", now.AddDate(0, 0, -30).Add(-time.Hour), [3]sql.NullInt64{interval(30), {}, interval(0)}, expirySourceLogin, -1, true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expiry := newPasswordExpiry("vaultadmin", tc.pwdate, tc.intervals, now, defaultPasswordExpiryWarningDays)
+			if expiry.Source != tc.source || expiry.Warning != tc.warning || (expiry.Expires != nil) != tc.expires {
+				t.Fatalf("unexpected expiry: %#v", expiry)
+			}
+			if tc.expires && *expiry.DaysUntilExpiry != tc.days {
+				t.Fatalf("expected %d days until expiry, got %d", tc.days, *expiry.DaysUntilExpiry)
+			}
+		})
+	}
+}
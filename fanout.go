@@ -0,0 +1,265 @@
+package sybase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/mitchellh/mapstructure"
+)
+
+// primaryServer names the server of the connection_url in server statuses.
+const primaryServer = "primary"
+
+// targetServer is an additional server on which every login is created,
+// renewed and revoked along with the primary. It has its own login, as
+// servers that are not login-replicated do not share one. Every other
+// parameter is the same as the primary's.
+type targetServer struct {
+	Name          string `json:"name" mapstructure:"name" structs:"name"`
+	ConnectionURL string `json:"connection_url" mapstructure:"connection_url" structs:"connection_url"`
+	Username      string `json:"username" mapstructure:"username" structs:"username"`
+	Password      string `json:"password" mapstructure:"password" structs:"password"`
+}
+
+// fanoutTarget is a configured target server.
+type fanoutTarget struct {
+	name string
+	db   *SYBASE
+}
+
+// ServerStatus is the outcome of an operation on one server.
+type ServerStatus struct {
+	Server string `json:"server"`
+
+	// Err is the error the operation failed with on the server, if any.
+	Err error `json:"-"`
+
+	// Compensated is set when the operation succeeded on the server, but was
+	// undone because it failed on another.
+	Compensated bool `json:"compensated,omitempty"`
+
+	// CompensationErr is the error undoing the operation failed with.
+	CompensationErr error `json:"-"`
+}
+
+func (s ServerStatus) String() string {
+	switch {
+	case s.Err != nil:
+		return fmt.Sprintf("%s: failed: %s", s.Server, s.Err)
+	case s.CompensationErr != nil:
+		return fmt.Sprintf("%s: succeeded, could not be undone: %s", s.Server, s.CompensationErr)
+	case s.Compensated:
+		return fmt.Sprintf("%s: succeeded, undone", s.Server)
+	default:
+		return fmt.Sprintf("%s: succeeded", s.Server)
+	}
+}
+
+// FanoutError is returned when an operation fails on any of the servers, with
+// the status of the operation on each of them.
+type FanoutError struct {
+	Operation string         `json:"operation"`
+	Statuses  []ServerStatus `json:"statuses"`
+}
+
+func (e *FanoutError) Error() string {
+	lines := make([]string, len(e.Statuses))
+	for i, s := range e.Statuses {
+		lines[i] = "  " + s.String()
+	}
+	return fmt.Sprintf("%s failed on %d of %d servers:\n%s", e.Operation, e.failed(), len(e.Statuses), strings.Join(lines, "\n"))
+}
+
+func (e *FanoutError) failed() int {
+	n := 0
+	for _, s := range e.Statuses {
+		if s.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// validateTargetServers checks the target_servers parameter.
+func validateTargetServers(targets []targetServer) error {
+	names := map[string]bool{primaryServer: true}
+	for _, t := range targets {
+		switch {
+		case t.Name == "":
+			return fmt.Errorf("target_servers: a name is required")
+		case names[t.Name]:
+			return fmt.Errorf("target_servers: duplicate name %q", t.Name)
+		case t.ConnectionURL == "":
+			return fmt.Errorf("target_servers: %s: connection_url cannot be empty", t.Name)
+		}
+		names[t.Name] = true
+	}
+	return nil
+}
+
+// initTargets configures a SYBASE for each of the target servers in conf,
+// with the primary's parameters and the target's own connection_url and
+// login. On error, the targets configured so far are closed.
+func (m *SYBASE) initTargets(ctx context.Context, conf map[string]interface{}, verifyConnection bool) ([]fanoutTarget, error) {
+	var decoded struct {
+		TargetServers []targetServer `mapstructure:"target_servers"`
+	}
+	if err := mapstructure.WeakDecode(conf, &decoded); err != nil {
+		return nil, err
+	}
+	if err := validateTargetServers(decoded.TargetServers); err != nil {
+		return nil, err
+	}
+
+	var targets []fanoutTarget
+	for _, t := range decoded.TargetServers {
+		targetConf := make(map[string]interface{}, len(conf))
+		for k, v := range conf {
+			targetConf[k] = v
+		}
+		delete(targetConf, "target_servers")
+		targetConf["connection_url"] = t.ConnectionURL
+		targetConf["username"] = t.Username
+		targetConf["password"] = t.Password
+
+		db := new()
+		db.SQLConnectionProducer.Type = m.SQLConnectionProducer.Type
+		if _, err := db.Init(ctx, targetConf, verifyConnection); err != nil {
+			closeTargets(targets)
+			return nil, errwrap.Wrapf(fmt.Sprintf("error configuring target server %s: {{err}}", t.Name), err)
+		}
+		targets = append(targets, fanoutTarget{name: t.Name, db: db})
+	}
+	return targets, nil
+}
+
+func closeTargets(targets []fanoutTarget) error {
+	var result *multierror.Error
+	for _, t := range targets {
+		if err := t.db.Close(); err != nil {
+			result = multierror.Append(result, errwrap.Wrapf(fmt.Sprintf("target server %s: {{err}}", t.name), err))
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// createUser creates the login on the primary and then on each target
+// server. If creation fails on any server, the login is revoked on the
+// servers it was created on. The caller must hold the lock.
+func (m *SYBASE) createUser(ctx context.Context, statements dbplugin.Statements, username, password string, usernameConfig dbplugin.UsernameConfig, expiration time.Time) error {
+	if len(m.targets) == 0 {
+		return m.createLogin(ctx, statements, username, password, usernameConfig, expiration)
+	}
+
+	statuses := []ServerStatus{{Server: primaryServer}}
+	statuses[0].Err = m.createLogin(ctx, statements, username, password, usernameConfig, expiration)
+	if statuses[0].Err != nil {
+		return &FanoutError{Operation: "create", Statuses: statuses}
+	}
+
+	for _, t := range m.targets {
+		t.db.Lock()
+		err := t.db.createLogin(ctx, statements, username, password, usernameConfig, expiration)
+		t.db.Unlock()
+
+		statuses = append(statuses, ServerStatus{Server: t.name, Err: err})
+		if err == nil {
+			continue
+		}
+
+		// Undo the creation everywhere it succeeded, so that Vault does not
+		// leave behind logins it has no lease for
+		for i := range statuses[:len(statuses)-1] {
+			db := m
+			if i > 0 {
+				db = m.targets[i-1].db
+				db.RLock()
+			}
+			statuses[i].CompensationErr = db.revokeLogin(ctx, statements, username)
+			if i > 0 {
+				db.RUnlock()
+			}
+			statuses[i].Compensated = statuses[i].CompensationErr == nil
+			if statuses[i].CompensationErr != nil {
+				log.Printf("Could not revoke login '%s' on %s: %s", username, statuses[i].Server, statuses[i].CompensationErr)
+			}
+		}
+		return &FanoutError{Operation: "create", Statuses: statuses}
+	}
+	return nil
+}
+
+// renewUser renews the login on every server, whether or not it fails on
+// any of them. The caller must hold the lock.
+func (m *SYBASE) renewUser(ctx context.Context, statements dbplugin.Statements, username string, expiration time.Time) error {
+	return m.fanout("renew", func(db *SYBASE) error {
+		return db.renewLogin(ctx, statements, username, expiration)
+	})
+}
+
+// revokeUser revokes the login on every server, whether or not it fails on
+// any of them. A target server without the login, because it was added
+// after the login was created or creation there was already undone, counts
+// as revoked. The caller must hold the lock.
+func (m *SYBASE) revokeUser(ctx context.Context, statements dbplugin.Statements, username string) error {
+	return m.fanout("revoke", func(db *SYBASE) error {
+		if db != m {
+			exists, err := db.loginExists(ctx, username)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				log.Printf("Login '%s' does not exist on the target server, nothing to revoke", username)
+				return nil
+			}
+		}
+		return db.revokeLogin(ctx, statements, username)
+	})
+}
+
+// loginExists reports whether the server has the login.
+func (m *SYBASE) loginExists(ctx context.Context, username string) (bool, error) {
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, fmt.Sprintf(loginExistsSQL, quoteLiteral(username))).Scan(&count); err != nil {
+		return false, errwrap.Wrapf("could not look up login: {{err}}", newServerError(err))
+	}
+	return count > 0, nil
+}
+
+// fanout runs the operation on the primary and each target server, holding
+// the target's lock for reading.
+func (m *SYBASE) fanout(operation string, op func(db *SYBASE) error) error {
+	err := op(m)
+	if len(m.targets) == 0 {
+		return err
+	}
+
+	statuses := []ServerStatus{{Server: primaryServer, Err: err}}
+	failed := err != nil
+	for _, t := range m.targets {
+		t.db.RLock()
+		err := op(t.db)
+		t.db.RUnlock()
+
+		statuses = append(statuses, ServerStatus{Server: t.name, Err: err})
+		failed = failed || err != nil
+	}
+
+	if failed {
+		return &FanoutError{Operation: operation, Statuses: statuses}
+	}
+	return nil
+}
+
+const loginExistsSQL = `SELECT count(*) FROM master.dbo.syslogins WHERE name = %s`
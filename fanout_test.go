@@ -0,0 +1,111 @@
+package sybase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+func fanoutConf(targets ...string) map[string]interface{} {
+	var servers []interface{}
+	for _, t := range targets {
+		servers = append(servers, map[string]interface{}{
+			"name":           t,
+			"connection_url": "Server=" + t,
+			"username":       "sa",
+			"password":       "secret-" + t,
+		})
+	}
+	return map[string]interface{}{
+		"connection_url": "Server=fanout-primary",
+		"target_servers": servers,
+	}
+}
+
+func TestSYBASE_FanoutCreateUser(t *testing.T) {
+	db := newFakeSYBASE()
+	ctx := context.Background()
+	if _, err := db.Init(ctx, fanoutConf("fanout-reporting"), false); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	statements := dbplugin.Statements{
+		Creation:   []string{"CREATE LOGIN {{name}} WITH PASSWORD {{password}}"},
+		Revocation: []string{"DROP LOGIN {{name}}"},
+	}
+	usernameConfig := dbplugin.UsernameConfig{DisplayName: "test", RoleName: "test"}
+	if _, _, err := db.CreateUser(ctx, statements, usernameConfig, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if testFakeDriver.openConnections("Server=fanout-reporting") == 0 {
+		t.Fatal("expected the login to be created on the target server")
+	}
+	if _, ok := db.SecretValues()["secret-fanout-reporting"]; !ok {
+		t.Fatal("expected the target server's password to be a secret value")
+	}
+
+	// Creation fails on the second target and is undone on the others
+	if _, err := db.Init(ctx, fanoutConf("fanout-reporting", "fanout-fail"), false); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := db.CreateUser(ctx, statements, usernameConfig, time.Now().Add(time.Hour))
+	fanoutErr, ok := err.(*FanoutError)
+	if !ok {
+		t.Fatalf("expected a FanoutError, got %v", err)
+	}
+	if len(fanoutErr.Statuses) != 3 {
+		t.Fatalf("expected a status per server, got %v", fanoutErr.Statuses)
+	}
+	for _, s := range fanoutErr.Statuses[:2] {
+		if !s.Compensated {
+			t.Fatalf("expected the login to be revoked on %s: %s", s.Server, s)
+		}
+	}
+	if fanoutErr.Statuses[2].Err == nil {
+		t.Fatalf("expected creation to fail on %s", fanoutErr.Statuses[2].Server)
+	}
+
+	// Revocation goes on after a failure
+	err = db.RevokeUser(ctx, statements, "v_test")
+	if fanoutErr, ok := err.(*FanoutError); !ok || fanoutErr.failed() != 1 {
+		t.Fatalf("expected revocation to fail on one server, got %v", err)
+	}
+}
+
+func TestSYBASE_FanoutRevokeMissingLogin(t *testing.T) {
+	db := newFakeSYBASE()
+	ctx := context.Background()
+	// Revocation would fail on the target, were the login there
+	if _, err := db.Init(ctx, fanoutConf("fanout-nologin-fail"), false); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	statements := dbplugin.Statements{Revocation: []string{"DROP LOGIN {{name}}"}}
+	if err := db.RevokeUser(ctx, statements, "v_test"); err != nil {
+		t.Fatalf("expected a target without the login to count as revoked, got %v", err)
+	}
+
+	// The fake primary cannot run the default revocation, but the target
+	// is skipped before it gets that far
+	err := db.RevokeUser(ctx, dbplugin.Statements{}, "v_test")
+	if fanoutErr, ok := err.(*FanoutError); !ok || fanoutErr.Statuses[1].Err != nil {
+		t.Fatalf("expected the default revocation to skip the target, got %v", err)
+	}
+}
+
+func TestValidateTargetServers(t *testing.T) {
+	for _, targets := range [][]targetServer{
+		{{ConnectionURL: "Server=a"}},
+		{{Name: "primary", ConnectionURL: "Server=a"}},
+		{{Name: "a", ConnectionURL: "Server=a"}, {Name: "a", ConnectionURL: "Server=b"}},
+		{{Name: "a"}},
+	} {
+		if err := validateTargetServers(targets); err == nil {
+			t.Fatalf("expected an error for %v", targets)
+		}
+	}
+}
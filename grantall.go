@@ -0,0 +1,144 @@
+package sybase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// grantAllFunc is the template function that grants a privilege on every
+// object of a type and owner in the current database.
+const grantAllFunc = "grant_all"
+
+var errGrantAllOutsideCreation = fmt.Errorf("%s can only be used in creation statements", grantAllFunc)
+
+// grantAllTypes are the sysobjects types grant_all accepts.
+var grantAllTypes = map[string]bool{
+	"U":  true,
+	"V":  true,
+	"P":  true,
+	"SF": true,
+}
+
+// grantAll is a grant_all call. ASE has no GRANT ... ON ALL TABLES, so the
+// call renders as one GRANT per object, listed when the statement is
+// rendered.
+type grantAll struct {
+	Privilege string
+	Type      string
+	Owner     string
+	Grantee   string
+}
+
+// grantAllLister lists the names of the objects of a type and owner in a
+// database, or in the connection's current database if database is empty.
+type grantAllLister func(database, typ, owner string) ([]string, error)
+
+// grantAllOutsideCreation is the grant_all function of every template but
+// creation statements.
+func grantAllOutsideCreation(privilege, typ, owner string) (sqlFragment, error) {
+	return "", errGrantAllOutsideCreation
+}
+
+// grantAllFor returns the grant_all function for creation statements
+// rendered with vars into rendered. Objects are granted to the login being
+// created, the name variable.
+//
+// Each statement is rendered just before it runs, so the connection is
+// already in the database that earlier statements switched to. A USE earlier
+// in the same statement has not run yet, so the objects are listed in the
+// database of the last USE batch rendered so far instead.
+func grantAllFor(vars map[string]interface{}, list grantAllLister, rendered *bytes.Buffer) func(privilege, typ, owner string) (sqlFragment, error) {
+	return func(privilege, typ, owner string) (sqlFragment, error) {
+		grantee, _ := vars["name"].(string)
+		g := grantAll{
+			Privilege: strings.ToLower(privilege),
+			Type:      strings.ToUpper(typ),
+			Owner:     owner,
+			Grantee:   grantee,
+		}
+		if err := g.validate(); err != nil {
+			return "", err
+		}
+
+		var database string
+		for _, batch := range splitStatements(rendered.String()) {
+			if match := useRegex.FindStringSubmatch(batch); match != nil {
+				database = strings.Trim(match[1], `[]"`)
+			}
+		}
+
+		names, err := list(database, g.Type, g.Owner)
+		if err != nil {
+			return "", errwrap.Wrapf(fmt.Sprintf("%s: could not list objects: {{err}}", grantAllFunc), err)
+		}
+		return sqlFragment(g.statements(names)), nil
+	}
+}
+
+func (g grantAll) validate() error {
+	switch {
+	case !containsString(grantPrivileges, g.Privilege):
+		return fmt.Errorf("%s: invalid privilege %q", grantAllFunc, g.Privilege)
+	case !grantAllTypes[g.Type]:
+		return fmt.Errorf("%s: invalid object type %q", grantAllFunc, g.Type)
+	case !identifierRegex.MatchString(g.Owner):
+		return fmt.Errorf("%s: invalid owner %q", grantAllFunc, g.Owner)
+	case !identifierRegex.MatchString(g.Grantee):
+		return errGrantAllOutsideCreation
+	}
+	return nil
+}
+
+// statements returns a GRANT batch for each object, set apart from the text
+// around the call.
+func (g grantAll) statements(names []string) string {
+	var b bytes.Buffer
+	b.WriteString(";\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "GRANT %s ON %s.%s TO %s;\n", strings.ToUpper(g.Privilege), quoteIdent(g.Owner), quoteIdent(name), g.Grantee)
+	}
+	return b.String()
+}
+
+// grantAllObjects returns the lister grant_all uses in the session's
+// creation statements.
+func (s *session) grantAllObjects(ctx context.Context) grantAllLister {
+	return func(database, typ, owner string) ([]string, error) {
+		if database == "" {
+			if err := s.conn.QueryRowContext(ctx, currentDatabaseSQL).Scan(&database); err != nil {
+				return nil, newServerError(err)
+			}
+		}
+
+		rows, err := s.conn.QueryContext(ctx, fmt.Sprintf(grantAllObjectsSQL, quoteIdent(database), quoteLiteral(typ), quoteLiteral(owner)))
+		if err != nil {
+			return nil, newServerError(err)
+		}
+		defer rows.Close()
+
+		var names []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+		}
+		return names, rows.Err()
+	}
+}
+
+// placeholderObjects is the grant_all lister of render-statements, which
+// does not connect to the server. Every call renders a single GRANT on
+// placeholderObject.
+func placeholderObjects(database, typ, owner string) ([]string, error) {
+	return []string{placeholderObject}, nil
+}
+
+const currentDatabaseSQL = `SELECT db_name()`
+
+const grantAllObjectsSQL = `SELECT o.name FROM %[1]s..sysobjects o, %[1]s..sysusers u WHERE o.uid = u.uid AND o.type = %[2]s AND u.name = %[3]s ORDER BY o.name`
@@ -0,0 +1,125 @@
+package sybase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+func TestGrantAll_Render(t *testing.T) {
+	var listed []string
+	list := func(database, typ, owner string) ([]string, error) {
+		listed = append(listed, strings.Join([]string{database, typ, owner}, " "))
+		return []string{"orders", "odd]name"}, nil
+	}
+
+	vars := map[string]interface{}{"name": "v_test", "password": "A1a_b2"}
+	rendered, err := renderCreationStatement(`{{grant_all "select" "V" "dbo"}} USE [sales]; {{grant_all "select" "U" "dbo"}} GRANT EXECUTE ON dbo.totals TO {{name}}`, vars, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"GRANT SELECT ON [dbo].[orders] TO v_test",
+		"GRANT SELECT ON [dbo].[odd]]name] TO v_test",
+		"USE [sales]",
+		"GRANT SELECT ON [dbo].[orders] TO v_test",
+		"GRANT SELECT ON [dbo].[odd]]name] TO v_test",
+		"GRANT EXECUTE ON dbo.totals TO v_test",
+	}
+	batches := splitStatements(rendered)
+	if !reflect.DeepEqual(batches, expected) {
+		t.Fatalf("expected %q, got %q", expected, batches)
+	}
+
+	// Objects are listed in the current database until the statement
+	// switches to another one
+	if !reflect.DeepEqual(listed, []string{" V dbo", "sales U dbo"}) {
+		t.Fatalf("unexpected object lists: %q", listed)
+	}
+
+	for _, stmt := range []string{
+		`{{grant_all "all" "U" "dbo"}}`,
+		`{{grant_all "select" "S" "dbo"}}`,
+		`{{grant_all "select" "U" "dbo; DROP"}}`,
+	} {
+		if _, err := renderCreationStatement(stmt, vars, list); err == nil {
+			t.Fatalf("expected an error rendering %s", stmt)
+		}
+	}
+
+	// Rotation has no login to grant to
+	if _, err := renderCreationStatement(`{{grant_all "select" "U" "dbo"}}`, map[string]interface{}{"username": "sa"}, list); err == nil {
+		t.Fatal("expected an error without the name variable")
+	}
+
+	failing := func(database, typ, owner string) ([]string, error) {
+		return nil, errors.New("no such database")
+	}
+	if _, err := renderCreationStatement(`USE missing; {{grant_all "select" "U" "dbo"}}`, vars, failing); err == nil || !strings.Contains(err.Error(), "could not list objects") {
+		t.Fatalf("expected the object list to fail, got %v", err)
+	}
+}
+
+func TestGrantAll_OutsideCreation(t *testing.T) {
+	vars := map[string]interface{}{"name": "v_test"}
+	if _, err := renderStatement(`{{grant_all "select" "U" "dbo"}}`, vars); err == nil || !strings.Contains(err.Error(), "creation statements") {
+		t.Fatalf("expected a statement to reject grant_all, got %v", err)
+	}
+	if _, err := renderValue(`{{grant_all "select" "U" "dbo"}}`, vars); err == nil || !strings.Contains(err.Error(), "creation statements") {
+		t.Fatalf("expected a procedure parameter to reject grant_all, got %v", err)
+	}
+
+	db := newFakeSYBASE()
+	for _, statements := range []dbplugin.Statements{
+		{Creation: []string{"CREATE LOGIN {{name}} WITH PASSWORD {{password}}"}, Renewal: []string{`{{grant_all "select" "U" "dbo"}}`}},
+		{Creation: []string{"CREATE LOGIN {{name}} WITH PASSWORD {{password}}"}, Revocation: []string{`{{grant_all "select" "U" "dbo"}}`}},
+	} {
+		if _, err := db.RenderStatements(statements, nil); err == nil || !strings.Contains(err.Error(), "creation statements") {
+			t.Fatalf("expected render-statements to reject grant_all, got %v", err)
+		}
+	}
+	if _, err := db.RenderStatements(dbplugin.Statements{}, []string{`ALTER LOGIN {{username}} WITH PASSWORD {{password}} {{grant_all "select" "U" "dbo"}}`}); err == nil {
+		t.Fatal("expected render-statements to reject grant_all in rotation statements")
+	}
+
+	rendered, err := db.RenderStatements(dbplugin.Statements{Creation: []string{`{{grant_all "select" "U" "dbo"}}`}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "GRANT SELECT ON [dbo].[" + placeholderObject + "] TO " + placeholderName
+	if len(rendered["creation"]) != 1 || rendered["creation"][0] != expected {
+		t.Fatalf("expected the creation call to render a placeholder grant, got %q", rendered["creation"])
+	}
+}
+
+func TestGrantAll_Exec(t *testing.T) {
+	db := newFakeSYBASE()
+	ctx := context.Background()
+	if _, err := db.Init(ctx, map[string]interface{}{"connection_url": "Server=grant-all"}, false); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conn, err := db.getConnection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := newSession(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.close(ctx)
+
+	vars := map[string]interface{}{"name": "v_test"}
+	if err := sess.execCreationStatements(ctx, []string{`USE sales; {{grant_all "select" "V" "dbo"}}`}, vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.execStatements(ctx, []string{`{{grant_all "select" "V" "dbo"}}`}, vars); err == nil || !strings.Contains(err.Error(), "creation statements") {
+		t.Fatalf("expected renewal to reject grant_all, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package sybase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// grantPrivileges are the object privileges a grants document can grant.
+var grantPrivileges = []string{"select", "insert", "update", "delete", "references", "execute"}
+
+// grantsDocument is a declarative role definition, compiled into creation
+// statements in place of hand-written T-SQL. Logins it creates are revoked
+// with the default revocation, which drops their users from every database
+// and drops the login.
+type grantsDocument struct {
+	// DefaultDatabase is the login's default database. It defaults to the
+	// first of Databases, or master if there are none.
+	DefaultDatabase string `json:"default_database"`
+
+	// Roles are the server roles granted to the login.
+	Roles []string `json:"roles"`
+
+	// Databases are the databases the login gets a user in.
+	Databases []grantsDatabase `json:"databases"`
+}
+
+// grantsDatabase is a database in which the login gets a user.
+type grantsDatabase struct {
+	Name string `json:"name"`
+
+	// Group is the group the user is added to, if any.
+	Group string `json:"group"`
+
+	Permissions []grantsPermission `json:"permissions"`
+}
+
+// grantsPermission grants privileges on an object to the user.
+type grantsPermission struct {
+	Privileges []string `json:"privileges"`
+
+	// On is the object, optionally qualified by its owner, as in
+	// "dbo.orders".
+	On string `json:"on"`
+}
+
+func (g *grantsDocument) validate() error {
+	if g.DefaultDatabase != "" && !identifierRegex.MatchString(g.DefaultDatabase) {
+		return fmt.Errorf("grants: invalid default database %q", g.DefaultDatabase)
+	}
+	for _, role := range g.Roles {
+		if !identifierRegex.MatchString(role) {
+			return fmt.Errorf("grants: invalid role %q", role)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, db := range g.Databases {
+		if !identifierRegex.MatchString(db.Name) {
+			return fmt.Errorf("grants: invalid database %q", db.Name)
+		}
+		if seen[db.Name] {
+			return fmt.Errorf("grants: database %s is listed twice", db.Name)
+		}
+		seen[db.Name] = true
+
+		if db.Group != "" && !identifierRegex.MatchString(db.Group) {
+			return fmt.Errorf("grants: database %s: invalid group %q", db.Name, db.Group)
+		}
+
+		for _, p := range db.Permissions {
+			for _, part := range strings.Split(p.On, ".") {
+				if !identifierRegex.MatchString(part) {
+					return fmt.Errorf("grants: database %s: invalid object %q", db.Name, p.On)
+				}
+			}
+			if len(p.Privileges) == 0 {
+				return fmt.Errorf("grants: database %s: no privileges on %s", db.Name, p.On)
+			}
+			for _, privilege := range p.Privileges {
+				if !containsString(grantPrivileges, strings.ToLower(privilege)) {
+					return fmt.Errorf("grants: database %s: invalid privilege %q on %s", db.Name, privilege, p.On)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// statements compiles the document into creation statements. Every name has
+// been validated as an identifier, so none needs quoting. sp_addlogin is used
+// rather than CREATE LOGIN as it works with every server version.
+func (g *grantsDocument) statements() []string {
+	defaultDatabase := g.DefaultDatabase
+	switch {
+	case defaultDatabase != "":
+	case len(g.Databases) > 0:
+		defaultDatabase = g.Databases[0].Name
+	default:
+		defaultDatabase = "master"
+	}
+
+	batches := []string{
+		"USE master",
+		fmt.Sprintf("sp_addlogin {{name}}, {{password}}, %s", defaultDatabase),
+	}
+	for _, role := range g.Roles {
+		batches = append(batches, fmt.Sprintf("GRANT ROLE %s TO {{name}}", role))
+	}
+
+	for _, db := range g.Databases {
+		batches = append(batches, "USE "+db.Name)
+		if db.Group != "" {
+			batches = append(batches, fmt.Sprintf("sp_adduser {{name}}, {{name}}, %s", db.Group))
+		} else {
+			batches = append(batches, "sp_adduser {{name}}")
+		}
+
+		for _, p := range db.Permissions {
+			privileges := make([]string, len(p.Privileges))
+			for i, privilege := range p.Privileges {
+				privileges[i] = strings.ToUpper(privilege)
+			}
+			batches = append(batches, fmt.Sprintf("GRANT %s ON %s TO {{name}}", strings.Join(privileges, ", "), p.On))
+		}
+	}
+
+	return []string{strings.Join(batches, ";\n")}
+}
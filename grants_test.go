@@ -0,0 +1,72 @@
+package sybase
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+func TestRoleDocument_Grants(t *testing.T) {
+	role, creation, err := parseRoleDocument(dbplugin.Statements{
+		Creation: []string{`{
+		  "provisioning": "grants",
+		  "grants": {
+		    "roles": ["analyst_role"],
+		    "databases": [
+		      {"name": "sales", "group": "readers", "permissions": [{"privileges": ["select", "update"], "on": "dbo.orders"}]},
+		      {"name": "reports"}
+		    ]
+		  }
+		}`},
+		Renewal: []string{"sp_locklogin {{name}}, 'unlock'"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.storedProcedures() || len(creation) != 1 {
+		t.Fatalf("unexpected role: %#v, %v", role, creation)
+	}
+
+	vars := map[string]interface{}{"name": "v_test", "password": "A1a_b2"}
+	rendered, err := renderStatement(creation[0], vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"USE master",
+		"sp_addlogin v_test, A1a_b2, sales",
+		"GRANT ROLE analyst_role TO v_test",
+		"USE sales",
+		"sp_adduser v_test, v_test, readers",
+		"GRANT SELECT, UPDATE ON dbo.orders TO v_test",
+		"USE reports",
+		"sp_adduser v_test",
+	}
+	if actual := splitStatements(rendered); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+
+	for name, statements := range map[string]dbplugin.Statements{
+		"missing grants":      {Creation: []string{`{"provisioning": "grants"}`}},
+		"grants unused":       {Creation: []string{`{"grants": {}}`, "sp_addlogin {{name}}, {{password}}"}},
+		"creation statements": {Creation: []string{`{"provisioning": "grants", "grants": {}}`, "sp_addlogin {{name}}, {{password}}"}},
+		"revocation":          {Creation: []string{`{"provisioning": "grants", "grants": {}}`}, Revocation: []string{"sp_droplogin {{name}}"}},
+		"invalid database":    {Creation: []string{`{"provisioning": "grants", "grants": {"databases": [{"name": "sales; DROP"}]}}`}},
+		"duplicate database":  {Creation: []string{`{"provisioning": "grants", "grants": {"databases": [{"name": "a"}, {"name": "a"}]}}`}},
+		"invalid privilege":   {Creation: []string{`{"provisioning": "grants", "grants": {"databases": [{"name": "a", "permissions": [{"privileges": ["all"], "on": "t"}]}]}}`}},
+		"invalid object":      {Creation: []string{`{"provisioning": "grants", "grants": {"databases": [{"name": "a", "permissions": [{"privileges": ["select"], "on": "dbo..t"}]}]}}`}},
+		"invalid role":        {Creation: []string{`{"provisioning": "grants", "grants": {"roles": ["{{password}}"]}}`}},
+	} {
+		if _, _, err := parseRoleDocument(statements); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+
+	// A templated statement is a creation statement, not a second document
+	_, _, err = parseRoleDocument(dbplugin.Statements{Creation: []string{`{"provisioning": "grants", "grants": {}}`, `{{grant_all "select" "U" "dbo"}}`}})
+	if err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Fatalf("expected creation statements to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package sybase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// Resource limit types supported by sp_add_resource_limit.
+const (
+	limitIOCost      = "io_cost"
+	limitElapsedTime = "elapsed_time"
+	limitRowCount    = "row_count"
+	limitTempdbSpace = "tempdb_space"
+)
+
+// allTimes is the time range ASE defines out of the box.
+const allTimes = "at all times"
+
+var (
+	// limitEnforced, limitAction and limitScope map the names used in role
+	// documents to the codes sp_add_resource_limit takes.
+	limitEnforced = map[string]int{
+		"prerun":    1,
+		"execution": 2,
+		"both":      3,
+	}
+	limitAction = map[string]int{
+		"warn":              1,
+		"abort_batch":       2,
+		"abort_transaction": 3,
+		"kill_session":      4,
+	}
+	limitScope = map[string]int{
+		"query":             1,
+		"batch":             2,
+		"transaction":       4,
+		"batch_transaction": 6,
+	}
+
+	weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+	timeOfDayRegex = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+)
+
+// resourceLimit is a limit attached to every login the role creates. The
+// optional Enforced, Action and Scope fields are left to the server's
+// defaults for the limit type when empty.
+type resourceLimit struct {
+	Type  string `json:"type"`
+	Value int64  `json:"value"`
+
+	// TimeRange is the name of the range during which the limit applies,
+	// either one defined in TimeRanges or one that exists on the server.
+	// It defaults to "at all times".
+	TimeRange string `json:"time_range"`
+
+	// App restricts the limit to sessions of the named application.
+	App string `json:"app"`
+
+	Enforced string `json:"enforced"`
+	Action   string `json:"action"`
+	Scope    string `json:"scope"`
+}
+
+// timeRange is a named time range created for the role's limits if it does
+// not exist yet. Time ranges are shared by every login on the server, so
+// they are never dropped.
+type timeRange struct {
+	Name      string `json:"name"`
+	StartDay  string `json:"start_day"`
+	EndDay    string `json:"end_day"`
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+func (l *resourceLimit) validate() error {
+	switch l.Type {
+	case limitIOCost, limitElapsedTime, limitRowCount, limitTempdbSpace:
+	default:
+		return fmt.Errorf("invalid resource limit type %q", l.Type)
+	}
+	if l.Value <= 0 {
+		return fmt.Errorf("resource limit %s: value must be positive", l.Type)
+	}
+	for _, code := range []struct {
+		field, value string
+		codes        map[string]int
+	}{
+		{"enforced", l.Enforced, limitEnforced},
+		{"action", l.Action, limitAction},
+		{"scope", l.Scope, limitScope},
+	} {
+		if _, ok := code.codes[code.value]; code.value != "" && !ok {
+			return fmt.Errorf("resource limit %s: invalid %s %q", l.Type, code.field, code.value)
+		}
+	}
+	return nil
+}
+
+func (r *timeRange) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("a time range name is required")
+	}
+	if strings.EqualFold(r.Name, allTimes) {
+		return fmt.Errorf("time range %q is predefined", allTimes)
+	}
+	for _, day := range []string{r.StartDay, r.EndDay} {
+		if !containsString(weekdays, strings.ToLower(day)) {
+			return fmt.Errorf("time range %s: invalid day %q", r.Name, day)
+		}
+	}
+	for _, t := range []string{r.StartTime, r.EndTime} {
+		if !timeOfDayRegex.MatchString(t) {
+			return fmt.Errorf("time range %s: invalid time %q, must be HH:MM", r.Name, t)
+		}
+	}
+	return nil
+}
+
+// addTimeRangeQuery creates the time range unless one of the same name
+// already exists, in which case the existing definition is kept.
+func (r *timeRange) addTimeRangeQuery() string {
+	return fmt.Sprintf(addTimeRangeSQL, quoteLiteral(r.Name), quoteLiteral(r.Name),
+		quoteLiteral(r.StartDay), quoteLiteral(r.EndDay), quoteLiteral(r.StartTime), quoteLiteral(r.EndTime))
+}
+
+// addResourceLimitQuery attaches the limit to the login.
+func (l *resourceLimit) addResourceLimitQuery(username string) string {
+	rangeName := l.TimeRange
+	if rangeName == "" {
+		rangeName = allTimes
+	}
+	app := "NULL"
+	if l.App != "" {
+		app = string(quoteLiteral(l.App))
+	}
+
+	args := []string{
+		string(quoteLiteral(username)),
+		app,
+		string(quoteLiteral(rangeName)),
+		string(quoteLiteral(l.Type)),
+		fmt.Sprint(l.Value),
+	}
+
+	// The optional arguments are positional, so a later one given means the
+	// ones before it are passed as NULL
+	optional := []string{"NULL", "NULL", "NULL"}
+	last := -1
+	for i, code := range []struct {
+		value string
+		codes map[string]int
+	}{
+		{l.Enforced, limitEnforced},
+		{l.Action, limitAction},
+		{l.Scope, limitScope},
+	} {
+		if code.value != "" {
+			optional[i] = fmt.Sprint(code.codes[code.value])
+			last = i
+		}
+	}
+	args = append(args, optional[:last+1]...)
+
+	return "EXEC master.dbo.sp_add_resource_limit " + strings.Join(args, ", ")
+}
+
+// applyResourceLimits creates the role's time ranges and attaches its
+// resource limits to a newly created login.
+func (s *session) applyResourceLimits(ctx context.Context, role *roleDocument, username string) error {
+	for _, r := range role.TimeRanges {
+		if err := s.execQuery(ctx, r.addTimeRangeQuery()); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("could not add time range %s: {{err}}", r.Name), err)
+		}
+	}
+
+	for _, l := range role.ResourceLimits {
+		if err := s.execQuery(ctx, l.addResourceLimitQuery(username)); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("could not add %s resource limit: {{err}}", l.Type), err)
+		}
+		log.Printf("Added %s resource limit of %d to login '%s'", l.Type, l.Value, username)
+	}
+	return nil
+}
+
+// dropResourceLimits removes every resource limit attached to the login.
+// It has to run before the login is dropped, as ASE leaves the limits of a
+// dropped login behind.
+func (s *session) dropResourceLimits(ctx context.Context, username string) error {
+	if err := s.execQuery(ctx, fmt.Sprintf(dropResourceLimitsSQL, quoteLiteral(username), quoteLiteral(username))); err != nil {
+		return errwrap.Wrapf("could not drop resource limits: {{err}}", err)
+	}
+	return nil
+}
+
+const addTimeRangeSQL = `
+IF NOT EXISTS
+  (SELECT name
+   FROM master.dbo.systimeranges
+   WHERE name = %s)
+BEGIN
+  EXEC master.dbo.sp_add_time_range %s, %s, %s, %s, %s
+END
+`
+
+const dropResourceLimitsSQL = `
+IF EXISTS
+  (SELECT name
+   FROM master.dbo.sysresourcelimits
+   WHERE name = %s)
+BEGIN
+  EXEC master.dbo.sp_drop_resource_limit %s
+END
+`
@@ -0,0 +1,67 @@
+package sybase
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+func TestResourceLimit_Query(t *testing.T) {
+	for _, tc := range []struct {
+		limit    resourceLimit
+		expected string
+	}{
+		{
+			resourceLimit{Type: limitRowCount, Value: 10000},
+			`EXEC master.dbo.sp_add_resource_limit 'v_test', NULL, 'at all times', 'row_count', 10000`,
+		},
+		{
+			resourceLimit{Type: limitElapsedTime, Value: 600, TimeRange: "business_hours", App: "isql", Scope: "batch"},
+			`EXEC master.dbo.sp_add_resource_limit 'v_test', 'isql', 'business_hours', 'elapsed_time', 600, NULL, NULL, 2`,
+		},
+		{
+			resourceLimit{Type: limitIOCost, Value: 5000, Enforced: "prerun", Action: "kill_session"},
+			`EXEC master.dbo.sp_add_resource_limit 'v_test', NULL, 'at all times', 'io_cost', 5000, 1, 4`,
+		},
+	} {
+		if actual := tc.limit.addResourceLimitQuery("v_test"); actual != tc.expected {
+			t.Fatalf("expected %q, got %q", tc.expected, actual)
+		}
+	}
+
+	query := (&timeRange{Name: "business_hours", StartDay: "Monday", EndDay: "Friday", StartTime: "08:00", EndTime: "18:00"}).addTimeRangeQuery()
+	if !strings.Contains(query, `sp_add_time_range 'business_hours', 'Monday', 'Friday', '08:00', '18:00'`) {
+		t.Fatalf("unexpected time range query: %s", query)
+	}
+}
+
+func TestRoleDocument_ResourceLimits(t *testing.T) {
+	role, creation, err := parseRoleDocument(dbplugin.Statements{
+		Creation: []string{
+			`{"resource_limits": [{"type": "tempdb_space", "value": 2048, "time_range": "nights"}],
+			  "time_ranges": [{"name": "nights", "start_day": "monday", "end_day": "sunday", "start_time": "20:00", "end_time": "06:00"}]}`,
+			"sp_addlogin {{name}}, {{password}}",
+			`{{if .template_vars}}sp_modifylogin {{name}}, 'defdb', reports{{end}}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creation) != 2 || len(role.ResourceLimits) != 1 || len(role.TimeRanges) != 1 {
+		t.Fatalf("unexpected role: %#v", role)
+	}
+
+	for _, doc := range []string{
+		`{"resource_limits": [{"type": "cpu", "value": 1}]}`,
+		`{"resource_limits": [{"type": "row_count", "value": 0}]}`,
+		`{"resource_limits": [{"type": "row_count", "value": 1, "action": "explode"}]}`,
+		`{"time_ranges": [{"name": "at all times", "start_day": "monday", "end_day": "sunday", "start_time": "00:00", "end_time": "23:59"}]}`,
+		`{"time_ranges": [{"name": "nights", "start_day": "someday", "end_day": "sunday", "start_time": "20:00", "end_time": "06:00"}]}`,
+		`{"time_ranges": [{"name": "nights", "start_day": "monday", "end_day": "sunday", "start_time": "8pm", "end_time": "06:00"}]}`,
+	} {
+		if _, _, err := parseRoleDocument(dbplugin.Statements{Creation: []string{doc, "sp_addlogin {{name}}, {{password}}"}}); err == nil {
+			t.Fatalf("expected an error for %s", doc)
+		}
+	}
+}
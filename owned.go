@@ -0,0 +1,270 @@
+package sybase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// Policies for objects owned by a user that is being dropped.
+const (
+	ownedObjectsFail       = "fail"
+	ownedObjectsDrop       = "drop"
+	ownedObjectsTransferTo = "transfer_to:"
+)
+
+// ownedObjectKinds maps the sysobjects types a user can own and that have to
+// be handled before the user is dropped to their DDL keyword. Objects are
+// handled in ascending order of priority, so that triggers and views go
+// before the tables they depend on. Constraints go along with their tables.
+// Manual objects have no DDL the policies can use and are left to the
+// administrator.
+var ownedObjectKinds = map[string]struct {
+	keyword  string
+	priority int
+	manual   bool
+}{
+	"TR": {"TRIGGER", 0, false},
+	"P":  {"PROCEDURE", 1, false},
+	"XP": {"EXTENDED PROCEDURE", 1, true},
+	"SF": {"FUNCTION", 1, false},
+	"V":  {"VIEW", 2, false},
+	"U":  {"TABLE", 3, false},
+	"D":  {"DEFAULT", 4, false},
+	"R":  {"RULE", 4, false},
+}
+
+// ownedObject is an object in a database owned by the user being dropped.
+type ownedObject struct {
+	ID   int
+	Name string
+	Type string
+}
+
+func (o ownedObject) String() string {
+	return strings.ToLower(ownedObjectKinds[o.Type].keyword) + " " + o.Name
+}
+
+// userDatabase is a database in which a login has a user, or an alias to
+// another user.
+type userDatabase struct {
+	Name  string
+	User  string
+	UID   int
+	Alias bool
+}
+
+// validateOwnedObjectsPolicy checks the owned_objects_policy parameter.
+func validateOwnedObjectsPolicy(policy string) error {
+	switch {
+	case policy == "", policy == ownedObjectsFail, policy == ownedObjectsDrop:
+		return nil
+	case strings.HasPrefix(policy, ownedObjectsTransferTo):
+		if strings.TrimPrefix(policy, ownedObjectsTransferTo) == "" {
+			return fmt.Errorf("owned_objects_policy %q requires a user", policy)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid owned_objects_policy %q, must be %q, %q or %q", policy, ownedObjectsFail, ownedObjectsDrop, ownedObjectsTransferTo+"<user>")
+	}
+}
+
+// checkOwnedObjectsPolicy checks that the server can apply the owned objects
+// policy. Transferring objects takes ALTER ... MODIFY OWNER, which only
+// exists from ASE 15.7 on.
+func checkOwnedObjectsPolicy(policy string, caps *Capabilities) error {
+	if strings.HasPrefix(policy, ownedObjectsTransferTo) && !caps.modern() {
+		return fmt.Errorf("owned_objects_policy %q needs ALTER ... MODIFY OWNER, which this server does not support; it needs ASE 15.7 or later", policy)
+	}
+	return nil
+}
+
+// userDatabases returns the databases in which the login has a user or an
+// alias.
+// Databases that cannot be read, for example because they are offline, are
+// skipped.
+func (s *session) userDatabases(ctx context.Context, username string) ([]userDatabase, error) {
+	rows, err := s.conn.QueryContext(ctx, listDatabasesSQL)
+	if err != nil {
+		return nil, errwrap.Wrapf("could not list databases: {{err}}", newServerError(err))
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var databases []userDatabase
+	for _, name := range names {
+		userRows, err := s.conn.QueryContext(ctx, fmt.Sprintf(findUserSQL, quoteIdent(name), quoteLiteral(username)))
+		if err != nil {
+			log.Printf("Could not look for user '%s' in database '%s': %s", username, name, newServerError(err))
+			continue
+		}
+		if userRows.Next() {
+			database := userDatabase{Name: name}
+			if err := userRows.Scan(&database.UID, &database.User); err != nil {
+				userRows.Close()
+				return nil, err
+			}
+			databases = append(databases, database)
+			userRows.Close()
+			continue
+		}
+		userRows.Close()
+
+		var aliases int
+		if err := s.conn.QueryRowContext(ctx, fmt.Sprintf(findAliasSQL, quoteIdent(name), quoteLiteral(username))).Scan(&aliases); err != nil {
+			log.Printf("Could not look for alias '%s' in database '%s': %s", username, name, newServerError(err))
+			continue
+		}
+		if aliases > 0 {
+			databases = append(databases, userDatabase{Name: name, Alias: true})
+		}
+	}
+	return databases, nil
+}
+
+// ownedObjects returns the objects the user owns in the database, in the
+// order they have to be handled.
+func (s *session) ownedObjects(ctx context.Context, database userDatabase) ([]ownedObject, error) {
+	types := make([]string, 0, len(ownedObjectKinds))
+	for t := range ownedObjectKinds {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	rows, err := s.conn.QueryContext(ctx, fmt.Sprintf(ownedObjectsSQL, quoteIdent(database.Name), database.UID, quotedList(types)))
+	if err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("could not list objects in database %s: {{err}}", database.Name), newServerError(err))
+	}
+	defer rows.Close()
+
+	var objects []ownedObject
+	for rows.Next() {
+		var o ownedObject
+		if err := rows.Scan(&o.ID, &o.Name, &o.Type); err != nil {
+			return nil, err
+		}
+		o.Type = strings.TrimSpace(o.Type)
+		objects = append(objects, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		return ownedObjectKinds[objects[i].Type].priority < ownedObjectKinds[objects[j].Type].priority
+	})
+	return objects, nil
+}
+
+// handleOwnedObjects applies the owned objects policy to the objects the
+// user owns in the database, returning a description of each action taken.
+// The session is left in the database.
+func (s *session) handleOwnedObjects(ctx context.Context, policy string, database userDatabase) ([]string, error) {
+	objects, err := s.ownedObjects(ctx, database)
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+
+	if policy == "" || policy == ownedObjectsFail {
+		return nil, fmt.Errorf("user owns objects in database %s: %s", database.Name, ownedObjectNames(objects))
+	}
+
+	// Extended procedures are dropped with sp_dropextendedproc, which takes
+	// no owner, so leave them to the administrator before touching anything
+	if manual := manualObjects(objects); len(manual) > 0 {
+		return nil, fmt.Errorf("user owns objects in database %s that have to be dropped by hand, with sp_dropextendedproc: %s", database.Name, ownedObjectNames(manual))
+	}
+
+	// DROP PROCEDURE and friends take no database qualifier
+	if err := s.execQuery(ctx, fmt.Sprintf("USE %s", quoteIdent(database.Name))); err != nil {
+		return nil, err
+	}
+
+	owner := strings.TrimPrefix(policy, ownedObjectsTransferTo)
+	if policy != ownedObjectsDrop {
+		var count int
+		if err := s.conn.QueryRowContext(ctx, fmt.Sprintf(userExistsSQL, quoteLiteral(owner))).Scan(&count); err != nil {
+			return nil, newServerError(err)
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("cannot transfer objects to %s, no such user in database %s", owner, database.Name)
+		}
+	}
+
+	var actions []string
+	for _, o := range objects {
+		// Dropping or transferring a table takes its triggers and
+		// constraints along
+		var count int
+		if err := s.conn.QueryRowContext(ctx, fmt.Sprintf(objectOwnedSQL, o.ID, database.UID)).Scan(&count); err != nil {
+			return actions, newServerError(err)
+		}
+		if count == 0 {
+			continue
+		}
+
+		name := fmt.Sprintf("%s.%s", quoteIdent(database.User), quoteIdent(o.Name))
+		keyword := ownedObjectKinds[o.Type].keyword
+
+		var query, action string
+		if policy == ownedObjectsDrop {
+			query = fmt.Sprintf("DROP %s %s", keyword, name)
+			action = fmt.Sprintf("dropped %s in database %s", o, database.Name)
+		} else {
+			query = fmt.Sprintf("ALTER %s %s MODIFY OWNER %s PRESERVE PERMISSIONS", keyword, name, quoteIdent(owner))
+			action = fmt.Sprintf("transferred %s in database %s to %s", o, database.Name, owner)
+		}
+
+		if err := s.execQuery(ctx, query); err != nil {
+			return actions, errwrap.Wrapf(fmt.Sprintf("could not handle %s in database %s: {{err}}", o, database.Name), err)
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// manualObjects returns the objects the policies cannot handle.
+func manualObjects(objects []ownedObject) []ownedObject {
+	var manual []ownedObject
+	for _, o := range objects {
+		if ownedObjectKinds[o.Type].manual {
+			manual = append(manual, o)
+		}
+	}
+	return manual
+}
+
+func ownedObjectNames(objects []ownedObject) string {
+	names := make([]string, len(objects))
+	for i, o := range objects {
+		names[i] = o.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+const listDatabasesSQL = `SELECT name FROM master.dbo.sysdatabases ORDER BY name`
+
+const findUserSQL = `SELECT uid, name FROM %s.dbo.sysusers WHERE suid = suser_id(%s)`
+
+const findAliasSQL = `SELECT count(*) FROM %s.dbo.sysalternates WHERE suid = suser_id(%s)`
+
+const userExistsSQL = `SELECT count(*) FROM dbo.sysusers WHERE name = %s`
+
+const ownedObjectsSQL = `SELECT id, name, type FROM %s.dbo.sysobjects WHERE uid = %d AND type IN (%s) ORDER BY id`
+
+const objectOwnedSQL = `SELECT count(*) FROM dbo.sysobjects WHERE id = %d AND uid = %d`
@@ -0,0 +1,87 @@
+package sybase
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidateOwnedObjectsPolicy(t *testing.T) {
+	for _, policy := range []string{"", "fail", "drop", "transfer_to:dbo", "transfer_to:app_owner"} {
+		if err := validateOwnedObjectsPolicy(policy); err != nil {
+			t.Fatalf("%q: %s", policy, err)
+		}
+	}
+	for _, policy := range []string{"keep", "transfer_to:", "transfer:dbo", "DROP"} {
+		if err := validateOwnedObjectsPolicy(policy); err == nil {
+			t.Fatalf("%q: expected an error", policy)
+		}
+	}
+
+	err := (&SQLConnectionProducer{}).configure(map[string]interface{}{
+		"connection_url":       "Server=owned",
+		"owned_objects_policy": "transfer_to:",
+	})
+	if err == nil {
+		t.Fatal("expected an error for a transfer without a user")
+	}
+}
+
+func TestOwnedObject_String(t *testing.T) {
+	for o, expected := range map[ownedObject]string{
+		{Name: "scratch", Type: "U"}:      "table scratch",
+		{Name: "report", Type: "P"}:       "procedure report",
+		{Name: "scratch_ins", Type: "TR"}: "trigger scratch_ins",
+		{Name: "xp_audit", Type: "XP"}:    "extended procedure xp_audit",
+	} {
+		if actual := o.String(); actual != expected {
+			t.Fatalf("expected %q, got %q", expected, actual)
+		}
+	}
+}
+
+func TestCheckOwnedObjectsPolicy(t *testing.T) {
+	modern := &Capabilities{VersionNumber: 16000, Dialect: dialectModern}
+	legacy := &Capabilities{VersionNumber: 15500, Dialect: dialectLegacy}
+	for _, policy := range []string{"", "fail", "drop", "transfer_to:dbo"} {
+		if err := checkOwnedObjectsPolicy(policy, modern); err != nil {
+			t.Fatalf("%q: %s", policy, err)
+		}
+	}
+	for _, policy := range []string{"", "fail", "drop"} {
+		if err := checkOwnedObjectsPolicy(policy, legacy); err != nil {
+			t.Fatalf("%q: %s", policy, err)
+		}
+	}
+	if err := checkOwnedObjectsPolicy("transfer_to:dbo", legacy); err == nil || !strings.Contains(err.Error(), "15.7") {
+		t.Fatalf("expected a transfer on a legacy server to fail, got %v", err)
+	}
+}
+
+func TestSYBASE_InitRejectsTransferOnLegacyServer(t *testing.T) {
+	db := newFakeSYBASE()
+	_, err := db.Init(context.Background(), map[string]interface{}{
+		"connection_url":       "Server=legacy",
+		"dialect":              "legacy",
+		"owned_objects_policy": "transfer_to:dbo",
+	}, true)
+	if err == nil || !strings.Contains(err.Error(), "MODIFY OWNER") {
+		t.Fatalf("expected Init to reject the policy, got %v", err)
+	}
+	db.Close()
+}
+
+func TestManualObjects(t *testing.T) {
+	objects := []ownedObject{
+		{Name: "scratch", Type: "U"},
+		{Name: "xp_audit", Type: "XP"},
+		{Name: "report", Type: "P"},
+	}
+	manual := manualObjects(objects)
+	if len(manual) != 1 || manual[0].Name != "xp_audit" {
+		t.Fatalf("expected only the extended procedure, got %v", manual)
+	}
+	if names := ownedObjectNames(objects); names != "table scratch, extended procedure xp_audit, procedure report" {
+		t.Fatalf("unexpected names %q", names)
+	}
+}
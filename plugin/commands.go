@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	plugin "github.com/rberlind/vault-plugin-database-sybase"
+)
+
+// command is an operator subcommand that runs the plugin's logic directly
+// against ASE, without a Vault server.
+type command struct {
+	synopsis string
+	run      func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"check-connection": {
+		synopsis: "Connect to the server and describe it",
+		run:      checkConnectionCommand,
+	},
+	"check-privileges": {
+		synopsis: "Check that the configured login has the privileges the plugin needs",
+		run:      checkPrivilegesCommand,
+	},
+	"whoami": {
+		synopsis: "Show the configured login and its active roles",
+		run:      whoamiCommand,
+	},
+	"list-managed-logins": {
+		synopsis: "List the logins created by the plugin",
+		run:      listManagedLoginsCommand,
+	},
+	"reconcile": {
+		synopsis: "Compare managed logins with the leases of a Vault mount",
+		run:      reconcileCommand,
+	},
+	"render-statements": {
+		synopsis: "Render statements with placeholder values without connecting",
+		run:      renderStatementsCommand,
+	},
+	"revoke": {
+		synopsis: "Revoke a login created by the plugin",
+		run:      revokeCommand,
+	},
+	"root-password-expiry": {
+		synopsis: "Show when the configured login's password expires",
+		run:      rootPasswordExpiryCommand,
+	},
+	"rotate-root": {
+		synopsis: "Check that the configured login's password can be rotated",
+		run:      rotateRootCommand,
+	},
+	"sweep": {
+		synopsis: "Find, lock or drop managed logins older than a maximum TTL",
+		run:      sweepCommand,
+	},
+	"validate": {
+		synopsis: "Validate statements against the server without executing them",
+		run:      validateCommand,
+	},
+}
+
+// statementsFile is the format of the -statements file, and of the
+// validate_statements configuration parameter.
+type statementsFile struct {
+	Creation   []string `json:"creation"`
+	Renewal    []string `json:"renewal"`
+	Revocation []string `json:"revocation"`
+	Rotation   []string `json:"rotation"`
+}
+
+func (s statementsFile) roleStatements() dbplugin.Statements {
+	return dbplugin.Statements{
+		Creation:   s.Creation,
+		Renewal:    s.Renewal,
+		Revocation: s.Revocation,
+	}
+}
+
+func runCommand(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		return 1
+	}
+
+	if err := cmd.run(context.Background(), args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: vault-plugin-database-sybase <command> -config <file> [options]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "    %-24s %s\n", name, commands[name].synopsis)
+	}
+}
+
+// readJSON decodes the JSON file at path into v.
+func readJSON(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("could not parse %s: {{err}}", path), err)
+	}
+	return nil
+}
+
+// loadConfig reads a connection configuration, in the same form as the
+// parameters of Vault's database/config endpoint, and initializes a SYBASE
+// instance with it. Keys in exclude are removed from the configuration and
+// returned separately.
+func loadConfig(ctx context.Context, path string, exclude ...string) (*plugin.SYBASE, map[string]interface{}, error) {
+	return loadConfigVerify(ctx, path, true, exclude...)
+}
+
+// loadConfigVerify is loadConfig, optionally without connecting.
+func loadConfigVerify(ctx context.Context, path string, verifyConnection bool, exclude ...string) (*plugin.SYBASE, map[string]interface{}, error) {
+	if path == "" {
+		return nil, nil, fmt.Errorf("-config is required")
+	}
+
+	conf := map[string]interface{}{}
+	if err := readJSON(path, &conf); err != nil {
+		return nil, nil, err
+	}
+
+	excluded := map[string]interface{}{}
+	for _, k := range exclude {
+		if v, ok := conf[k]; ok {
+			excluded[k] = v
+			delete(conf, k)
+		}
+	}
+
+	db := plugin.NewSYBASE()
+	if _, err := db.Init(ctx, conf, verifyConnection); err != nil {
+		return nil, nil, err
+	}
+	return db, excluded, nil
+}
+
+// loadStatements reads statements from the file at path or, without one,
+// from validate_statements in the excluded configuration. It returns nil if
+// there are neither.
+func loadStatements(path string, excluded map[string]interface{}) (*statementsFile, error) {
+	var statements statementsFile
+	switch {
+	case path != "":
+		if err := readJSON(path, &statements); err != nil {
+			return nil, err
+		}
+	case excluded["validate_statements"] != nil:
+		// Round trip through JSON to reuse the struct tags of statementsFile
+		data, err := json.Marshal(excluded["validate_statements"])
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &statements); err != nil {
+			return nil, errwrap.Wrapf("invalid validate_statements: {{err}}", err)
+		}
+	default:
+		return nil, nil
+	}
+	return &statements, nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func validateCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON connection configuration")
+	statementsPath := flags.String("statements", "", "JSON file with creation, renewal, revocation and rotation statements; defaults to validate_statements from the configuration")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, excluded, err := loadConfig(ctx, *configPath, "validate_statements")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	statements, err := loadStatements(*statementsPath, excluded)
+	if err != nil {
+		return err
+	}
+	if statements == nil {
+		return fmt.Errorf("no statements to validate")
+	}
+
+	report, err := db.ValidateStatements(ctx, statements.roleStatements(), statements.Rotation)
+	if err != nil {
+		return err
+	}
+
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	if report.Failed() {
+		return fmt.Errorf("one or more statements failed validation")
+	}
+	return nil
+}
+
+func checkPrivilegesCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("check-privileges", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON connection configuration")
+	statementsPath := flags.String("statements", "", "JSON file with creation, renewal, revocation and rotation statements; defaults to validate_statements from the configuration")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, excluded, err := loadConfig(ctx, *configPath, "validate_statements", "strict_privilege_check")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	statements, err := loadStatements(*statementsPath, excluded)
+	if err != nil {
+		return err
+	}
+	if statements == nil {
+		statements = &statementsFile{}
+	}
+
+	report, err := db.CheckPrivileges(ctx, statements.roleStatements(), statements.Rotation)
+	if err != nil {
+		return err
+	}
+
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	if len(report.Missing) > 0 {
+		return fmt.Errorf("the login is missing one or more privileges")
+	}
+	return nil
+}
+
+func checkConnectionCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("check-connection", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON connection configuration")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, _, err := loadConfig(ctx, *configPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	info, err := db.CheckConnection(ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(info)
+}
+
+func whoamiCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("whoami", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON connection configuration")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, _, err := loadConfig(ctx, *configPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	info, err := db.Whoami(ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(info)
+}
+
+func listManagedLoginsCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("list-managed-logins", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON connection configuration")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, _, err := loadConfig(ctx, *configPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	logins, err := db.ListManagedLogins(ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(logins)
+}
+
+func renderStatementsCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("render-statements", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON connection configuration")
+	statementsPath := flags.String("statements", "", "JSON file with creation, renewal, revocation and rotation statements")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *statementsPath == "" {
+		return fmt.Errorf("-statements is required")
+	}
+
+	var statements statementsFile
+	if err := readJSON(*statementsPath, &statements); err != nil {
+		return err
+	}
+
+	db, _, err := loadConfigVerify(ctx, *configPath, false, "validate_statements")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rendered, err := db.RenderStatements(statements.roleStatements(), statements.Rotation)
+	if err != nil {
+		return err
+	}
+	return printJSON(rendered)
+}
+
+func revokeCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("revoke", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON connection configuration")
+	statementsPath := flags.String("statements", "", "JSON file with revocation statements; the default revocation is used if omitted")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: revoke -config <file> [-statements <file>] <login>")
+	}
+	login := flags.Arg(0)
+
+	var statements statementsFile
+	if *statementsPath != "" {
+		if err := readJSON(*statementsPath, &statements); err != nil {
+			return err
+		}
+	}
+
+	db, _, err := loadConfig(ctx, *configPath, "validate_statements")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.RevokeUser(ctx, statements.roleStatements(), login); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Revoked %s\n", login)
+	return nil
+}
+
+func rotateRootCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("rotate-root", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON connection configuration")
+	statementsPath := flags.String("statements", "", "JSON file with rotation statements; the default rotation is used if omitted")
+	dryRun := flags.Bool("dry-run", true, "Validate the rotation statements without changing the password; the only mode supported")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// A password changed outside Vault leaves the mount with the old one, so
+	// the real rotation is left to Vault's rotate-root endpoint
+	if !*dryRun {
+		return fmt.Errorf("rotate-root only validates the rotation; rotate the password with Vault's database/rotate-root/<name> endpoint")
+	}
+
+	var statements statementsFile
+	if *statementsPath != "" {
+		if err := readJSON(*statementsPath, &statements); err != nil {
+			return err
+		}
+	}
+
+	db, _, err := loadConfig(ctx, *configPath, "validate_statements")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := db.DryRunRotateRootCredentials(ctx, statements.Rotation)
+	if err != nil {
+		return err
+	}
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	if report.Failed() {
+		return fmt.Errorf("one or more rotation statements failed validation")
+	}
+	return nil
+}
+
+func sweepCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON connection configuration")
+	maxTTL := flags.Duration("max-ttl", 0, "Age after which a managed login is orphaned; at least the max_ttl of every role")
+	action := flags.String("action", plugin.SweepActionReport, "What to do with orphaned logins: report, lock or drop")
+	dryRun := flags.Bool("dry-run", true, "Only report what the action would do")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, _, err := loadConfig(ctx, *configPath, "validate_statements")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := db.SweepOrphanedLogins(ctx, plugin.SweepOptions{
+		MaxTTL: *maxTTL,
+		Action: *action,
+		DryRun: *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+func reconcileCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON connection configuration")
+	mount := flags.String("mount", "", "Path the database secrets engine is mounted at")
+	tolerance := flags.Duration("tolerance", 2*time.Minute, "Largest difference between a lease's issue time and a login's creation time")
+	revokeLogins := flags.Bool("revoke-logins", false, "Drop logins that have no lease")
+	revokeLeases := flags.Bool("revoke-leases", false, "Force-revoke leases that have no login")
+	dryRun := flags.Bool("dry-run", true, "Only report what -revoke-logins and -revoke-leases would do")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// The address and token come from VAULT_ADDR, VAULT_TOKEN and the other
+	// standard environment variables
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		return err
+	}
+
+	db, _, err := loadConfig(ctx, *configPath, "validate_statements")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := db.Reconcile(ctx, client, plugin.ReconcileOptions{
+		Mount:        *mount,
+		Tolerance:    *tolerance,
+		RevokeLogins: *revokeLogins,
+		RevokeLeases: *revokeLeases,
+		DryRun:       *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+func rootPasswordExpiryCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("root-password-expiry", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON connection configuration")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, _, err := loadConfig(ctx, *configPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	expiry, err := db.RootPasswordExpiry(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := printJSON(expiry); err != nil {
+		return err
+	}
+	if expiry.Warning {
+		return fmt.Errorf("%s", expiry)
+	}
+	return nil
+}
@@ -3,12 +3,19 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
 
 	"github.com/hashicorp/vault/helper/pluginutil"
 	plugin "github.com/rberlind/vault-plugin-database-sybase"
 )
 
 func main() {
+	// Vault always starts the plugin with flags only, so a leading
+	// non-flag argument selects one of the operator subcommands.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	apiClientMeta := &pluginutil.APIClientMeta{}
 	flags := apiClientMeta.FlagSet()
 	flags.Parse(os.Args[1:])
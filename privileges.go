@@ -0,0 +1,180 @@
+package sybase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+// baselinePrivileges are needed regardless of the statements: every role
+// creates a login, and the default revocation locks and drops the login and
+// drops its users from their databases.
+var baselinePrivileges = map[string]string{
+	"sso_role": "creating, locking and dropping logins",
+	"sa_role":  "dropping users from any database in the default revocation",
+}
+
+// statementPrivileges maps commands found in statements to the role they
+// need.
+var statementPrivileges = []struct {
+	command *regexp.Regexp
+	role    string
+}{
+	{regexp.MustCompile(`(?i)\b(create|alter|drop)\s+login\b`), "sso_role"},
+	{regexp.MustCompile(`(?i)\bsp_(addlogin|droplogin|locklogin|modifylogin|password)\b`), "sso_role"},
+	{regexp.MustCompile(`(?i)\bsp_audit\b`), "sso_role"},
+	{regexp.MustCompile(`(?i)\b(create|alter|drop)\s+login\s+profile\b`), "sso_role"},
+	{regexp.MustCompile(`(?i)\bgrant\s+role\b`), "sso_role"},
+	{regexp.MustCompile(`(?i)\bsp_(adduser|dropuser|changegroup)\b`), "sa_role"},
+	{regexp.MustCompile(`(?i)\bsp_(add_resource_limit|drop_resource_limit|add_time_range|bindexeclass|unbindexeclass|tempdb)\b`), "sa_role"},
+}
+
+// MissingPrivilege is a privilege the configured login lacks.
+type MissingPrivilege struct {
+	Privilege  string   `json:"privilege"`
+	RequiredBy []string `json:"required_by"`
+}
+
+// PrivilegeReport is the outcome of a privilege preflight check.
+type PrivilegeReport struct {
+	Login   string             `json:"login"`
+	Roles   []string           `json:"roles"`
+	Missing []MissingPrivilege `json:"missing"`
+}
+
+// Err summarizes the missing privileges as an error, or returns nil if none
+// are missing.
+func (r *PrivilegeReport) Err() error {
+	if len(r.Missing) == 0 {
+		return nil
+	}
+
+	var missing []string
+	for _, p := range r.Missing {
+		missing = append(missing, fmt.Sprintf("%s, required by %s", p.Privilege, strings.Join(p.RequiredBy, "; ")))
+	}
+	return fmt.Errorf("login %q is missing privileges:\n%s", r.Login, strings.Join(missing, "\n"))
+}
+
+// CheckPrivileges verifies that the configured login holds the roles the
+// plugin needs, and the roles and database access needed by the given
+// statements.
+func (m *SYBASE) CheckPrivileges(ctx context.Context, statements dbplugin.Statements, rotation []string) (*PrivilegeReport, error) {
+	rendered, err := m.RenderStatements(statements, rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := m.Whoami(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PrivilegeReport{
+		Login: info.Login,
+		Roles: info.Roles,
+	}
+
+	required := requiredPrivileges(rendered)
+	for _, privilege := range sortedKeys(required) {
+		var has int
+		if database := strings.TrimPrefix(privilege, "access to database "); database != privilege {
+			err = db.QueryRowContext(ctx, fmt.Sprintf(hasDBAccessSQL, quoteLiteral(database))).Scan(&has)
+		} else {
+			err = db.QueryRowContext(ctx, fmt.Sprintf(procRoleSQL, quoteLiteral(privilege))).Scan(&has)
+		}
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("could not check %s: {{err}}", privilege), err)
+		}
+
+		if has == 0 {
+			report.Missing = append(report.Missing, MissingPrivilege{
+				Privilege:  privilege,
+				RequiredBy: required[privilege],
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// checkPrivilegesAtInit runs the preflight check for the statements given in
+// validate_statements, failing or warning depending on
+// strict_privilege_check.
+func (m *SYBASE) checkPrivilegesAtInit(ctx context.Context) error {
+	statements := dbplugin.Statements{
+		Creation:   m.ValidationStatements.Creation,
+		Renewal:    m.ValidationStatements.Renewal,
+		Revocation: m.ValidationStatements.Revocation,
+	}
+	report, err := m.CheckPrivileges(ctx, statements, m.ValidationStatements.Rotation)
+	if err != nil {
+		return errwrap.Wrapf("error checking privileges: {{err}}", err)
+	}
+
+	if err := report.Err(); err != nil {
+		if m.StrictPrivilegeCheck {
+			return err
+		}
+		log.Printf("Warning: %s", err)
+	}
+	return nil
+}
+
+// requiredPrivileges returns the privileges needed by the rendered batches,
+// keyed by privilege, with the reasons they are needed.
+func requiredPrivileges(rendered map[string][]string) map[string][]string {
+	required := map[string][]string{}
+	add := func(privilege, reason string) {
+		for _, r := range required[privilege] {
+			if r == reason {
+				return
+			}
+		}
+		required[privilege] = append(required[privilege], reason)
+	}
+
+	for role, reason := range baselinePrivileges {
+		add(role, reason)
+	}
+
+	for _, op := range sortedKeys(rendered) {
+		for _, batch := range rendered[op] {
+			if match := useRegex.FindStringSubmatch(batch); match != nil {
+				add("access to database "+strings.Trim(match[1], `[]"`), fmt.Sprintf("%s statement %q", op, batch))
+				continue
+			}
+			for _, p := range statementPrivileges {
+				if p.command.MatchString(batch) {
+					add(p.role, fmt.Sprintf("%s statement %q", op, batch))
+				}
+			}
+		}
+	}
+
+	return required
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+const procRoleSQL = `SELECT proc_role(%s)`
+
+const hasDBAccessSQL = `SELECT has_dbaccess(%s)`
@@ -0,0 +1,52 @@
+package sybase
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRequiredPrivileges(t *testing.T) {
+	required := requiredPrivileges(map[string][]string{
+		"creation": {
+			`sp_addlogin v_root_test, "secret", tempdb`,
+			`USE [my db]`,
+			`sp_adduser v_root_test`,
+			`GRANT SELECT ON t TO v_root_test`,
+		},
+		"revocation": {
+			`sp_droplogin v_root_test`,
+		},
+	})
+
+	for _, privilege := range []string{"sso_role", "sa_role", "access to database my db"} {
+		if len(required[privilege]) == 0 {
+			t.Fatalf("expected %q to be required: %v", privilege, required)
+		}
+	}
+	if len(required) != 3 {
+		t.Fatalf("unexpected privileges: %v", required)
+	}
+
+	var fromStatements bool
+	for _, reason := range required["sso_role"] {
+		if strings.Contains(reason, "sp_droplogin") {
+			fromStatements = true
+		}
+	}
+	if !fromStatements {
+		t.Fatalf("expected sso_role to be required by sp_droplogin: %v", required["sso_role"])
+	}
+}
+
+func TestPrivilegeReport_Err(t *testing.T) {
+	report := &PrivilegeReport{Login: "vault"}
+	if err := report.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	report.Missing = []MissingPrivilege{{Privilege: "sso_role", RequiredBy: []string{"creating logins"}}}
+	err := report.Err()
+	if err == nil || !strings.Contains(err.Error(), "sso_role, required by creating logins") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package sybase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// Parameter types of a procedure call.
+const (
+	paramTypeVarchar  = "varchar"
+	paramTypeInt      = "int"
+	paramTypeBit      = "bit"
+	paramTypeDatetime = "datetime"
+)
+
+// datetimeLayout is the format of datetime parameter values, and of the
+// literals they are passed as.
+const datetimeLayout = "2006-01-02 15:04:05"
+
+// datetimeOffsetLayout is the format of the expiration variable, which
+// datetime parameters also accept. ASE datetimes have no time zone, so the
+// offset is dropped and the time is passed as written.
+const datetimeOffsetLayout = "2006-01-02 15:04:05-0700"
+
+// procedureCall is a stored procedure called in stored procedure mode.
+type procedureCall struct {
+	// Name is the procedure, qualified as needed, for example
+	// "dba..vault_create_login".
+	Name string `json:"name"`
+
+	// Params are passed by position, so they must be listed in the order the
+	// procedure declares them.
+	Params []procedureParam `json:"params"`
+}
+
+// procedureParam is a parameter of a procedure call. Value is a template
+// with the same variables as the statements of the operation; it is quoted
+// as a literal of its type, so it needs no SQL escaping.
+type procedureParam struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Output bool   `json:"output"`
+}
+
+func (c *procedureCall) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("a procedure name is required")
+	}
+	// The name is part of the call's batch, so it must be a possibly
+	// qualified identifier, as in "dba..vault_create_login"
+	parts := strings.Split(c.Name, ".")
+	if len(parts) > 3 || !identifierRegex.MatchString(parts[len(parts)-1]) {
+		return fmt.Errorf("invalid procedure name %q", c.Name)
+	}
+	for _, part := range parts[:len(parts)-1] {
+		if part != "" && !identifierRegex.MatchString(part) {
+			return fmt.Errorf("invalid procedure name %q", c.Name)
+		}
+	}
+	for _, p := range c.Params {
+		switch p.Type {
+		case "", paramTypeVarchar, paramTypeInt, paramTypeBit, paramTypeDatetime:
+		default:
+			return fmt.Errorf("procedure %s: invalid type %q for parameter %s", c.Name, p.Type, p.Name)
+		}
+	}
+	return nil
+}
+
+// args renders the parameter values and converts them to their types.
+// Output parameters without a value are passed as NULL.
+func (c *procedureCall) args(vars map[string]interface{}) ([]interface{}, error) {
+	args := make([]interface{}, len(c.Params))
+	for i, p := range c.Params {
+		if p.Output && p.Value == "" {
+			continue
+		}
+
+		value, err := renderValue(p.Value, vars)
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("procedure %s, parameter %s: {{err}}", c.Name, p.Name), err)
+		}
+		if args[i], err = convertParam(p.Type, value); err != nil {
+			return nil, fmt.Errorf("procedure %s, parameter %s: %s", c.Name, p.Name, err)
+		}
+	}
+	return args, nil
+}
+
+func convertParam(typ, value string) (interface{}, error) {
+	switch typ {
+	case "", paramTypeVarchar:
+		return value, nil
+	case paramTypeInt:
+		return strconv.ParseInt(value, 10, 64)
+	case paramTypeBit:
+		return strconv.ParseBool(value)
+	case paramTypeDatetime:
+		if t, err := time.Parse(datetimeOffsetLayout, value); err == nil {
+			return t, nil
+		}
+		return time.Parse(datetimeLayout, value)
+	default:
+		return nil, fmt.Errorf("invalid type %q", typ)
+	}
+}
+
+// procedureQuery is the batch that calls the procedure with the arguments,
+// collecting the return status and output parameters in variables. A nonzero
+// status raises an error, and the output parameters are selected after the
+// call. Names have been validated as identifiers, and every argument is
+// quoted as a literal.
+func (c *procedureCall) procedureQuery(args []interface{}) string {
+	declare := []string{"@vault_status int"}
+	var pre, params, outputs []string
+	for i, p := range c.Params {
+		if !p.Output {
+			params = append(params, sqlLiteral(args[i]))
+			continue
+		}
+
+		variable := fmt.Sprintf("@vault_output%d", len(outputs)+1)
+		declare = append(declare, variable+" "+procedureParamTypes[p.Type])
+		if args[i] != nil {
+			pre = append(pre, fmt.Sprintf("SELECT %s = %s", variable, sqlLiteral(args[i])))
+		}
+		params = append(params, variable+" OUTPUT")
+		outputs = append(outputs, variable)
+	}
+
+	lines := append([]string{"DECLARE " + strings.Join(declare, ", ")}, pre...)
+	lines = append(lines,
+		strings.TrimSpace(fmt.Sprintf("EXEC @vault_status = %s %s", c.Name, strings.Join(params, ", "))),
+		fmt.Sprintf("IF @vault_status != 0\n  RAISERROR 17001 %s, @vault_status", quoteLiteral(fmt.Sprintf("procedure %s returned status %%1!", c.Name))),
+	)
+	if len(outputs) > 0 {
+		lines = append(lines, fmt.Sprintf("SELECT %s AS %s, %s", quoteLiteral(procedureOutputsColumn), procedureOutputsColumn, strings.Join(outputs, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sqlLiteral formats a converted parameter value as a T-SQL literal.
+func sqlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return string(quoteLiteral(v))
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return string(quoteLiteral(v.Format(datetimeLayout)))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// execProcedure calls the procedure on a connection of the pool, so that
+// max_open_connections and the context apply, and the connection is reset
+// before it returns to the pool. A nonzero return status is a failure.
+// Output parameters are logged, with secrets redacted. They are selected
+// after the procedure's own result sets, and failing to read them is an
+// error, although the procedure has run by then.
+func (m *SYBASE) execProcedure(ctx context.Context, call *procedureCall, vars map[string]interface{}) error {
+	secrets := secretValues(vars)
+
+	args, err := call.args(vars)
+	if err != nil {
+		return err
+	}
+
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	sess, err := newSession(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer sess.close(ctx)
+
+	log.Printf("Calling procedure %s", call.Name)
+	rows, err := sess.conn.QueryContext(ctx, call.procedureQuery(args))
+	if err != nil {
+		return redactError(newServerError(err), secrets)
+	}
+	defer rows.Close()
+
+	var names []string
+	for _, p := range call.Params {
+		if p.Output {
+			names = append(names, p.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	// Skip the result sets the procedure selects itself
+	for {
+		columns, err := rows.Columns()
+		if err != nil {
+			return redactError(newServerError(err), secrets)
+		}
+		if len(columns) == len(names)+1 && columns[0] == procedureOutputsColumn {
+			break
+		}
+		if !rows.NextResultSet() {
+			if err := rows.Err(); err != nil {
+				return redactError(newServerError(err), secrets)
+			}
+			// Drivers that only return the first result set end here
+			return fmt.Errorf("procedure %s was called, but its output parameters could not be read, because it returns result sets of its own", call.Name)
+		}
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return redactError(newServerError(err), secrets)
+		}
+		return fmt.Errorf("procedure %s was called, but returned no output parameters", call.Name)
+	}
+	values := make([]interface{}, len(names)+1)
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("could not read output parameters of %s: {{err}}", call.Name), err)
+	}
+	var outputs []string
+	for i, name := range names {
+		outputs = append(outputs, fmt.Sprintf("%s=%s", name, redactSecrets(fmt.Sprint(values[i+1]), secrets)))
+	}
+	log.Printf("Procedure %s output parameters: %s", call.Name, strings.Join(outputs, ", "))
+	return nil
+}
+
+// procedureOutputsColumn marks the result set of the output parameters.
+const procedureOutputsColumn = "vault_outputs"
+
+// procedureParamTypes are the types of the variables output parameters are
+// collected in.
+var procedureParamTypes = map[string]string{
+	"":                "varchar(255)",
+	paramTypeVarchar:  "varchar(255)",
+	paramTypeInt:      "int",
+	paramTypeBit:      "bit",
+	paramTypeDatetime: "datetime",
+}
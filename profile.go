@@ -0,0 +1,76 @@
+package sybase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// loginProfileVersion is the first ASE version, as in @@version_number, with
+// login profiles and ALTER LOGIN ... AUTO ACTIVATED ROLES.
+const loginProfileVersion = 15700
+
+// applyProfile assigns the role's login profile and default roles to a newly
+// created login, checking first that they exist.
+func (m *SYBASE) applyProfile(ctx context.Context, sess *session, role *roleDocument, username string) error {
+	if role.LoginProfile == "" && len(role.DefaultRoles) == 0 {
+		return nil
+	}
+
+	caps, err := m.Capabilities(ctx)
+	if err != nil {
+		return err
+	}
+	if caps.VersionNumber < loginProfileVersion {
+		return fmt.Errorf("login profiles and default roles require ASE 15.7 or later, the server is %d", caps.VersionNumber)
+	}
+
+	if role.LoginProfile != "" {
+		if err := checkLoginProfile(ctx, sess.conn, role.LoginProfile); err != nil {
+			return err
+		}
+		if err := sess.execQuery(ctx, fmt.Sprintf(modifyLoginProfileSQL, username, role.LoginProfile)); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("could not assign login profile %s: {{err}}", role.LoginProfile), err)
+		}
+		log.Printf("Assigned login profile %s to login '%s'", role.LoginProfile, username)
+	}
+
+	if len(role.DefaultRoles) > 0 {
+		for _, r := range role.DefaultRoles {
+			if err := checkRole(ctx, sess.conn, r); err != nil {
+				return err
+			}
+			if err := sess.execQuery(ctx, fmt.Sprintf(grantRoleSQL, r, username)); err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("could not grant role %s: {{err}}", r), err)
+			}
+		}
+		if err := sess.execQuery(ctx, fmt.Sprintf(autoActivateRolesSQL, username, strings.Join(role.DefaultRoles, ", "))); err != nil {
+			return errwrap.Wrapf("could not activate default roles: {{err}}", err)
+		}
+		log.Printf("Granted default roles %v to login '%s'", role.DefaultRoles, username)
+	}
+	return nil
+}
+
+// checkLoginProfile checks that the login profile exists.
+func checkLoginProfile(ctx context.Context, q queryer, profile string) error {
+	return checkExists(ctx, q, loginProfileExistsSQL, "login profile", profile)
+}
+
+// checkRole checks that the role exists.
+func checkRole(ctx context.Context, q queryer, role string) error {
+	return checkExists(ctx, q, roleExistsSQL, "role", role)
+}
+
+const loginProfileExistsSQL = `SELECT CASE WHEN lprofile_id(%s) IS NULL THEN 0 ELSE 1 END`
+
+const roleExistsSQL = `SELECT CASE WHEN role_id(%s) IS NULL THEN 0 ELSE 1 END`
+
+const modifyLoginProfileSQL = `ALTER LOGIN %s MODIFY LOGIN PROFILE %s`
+
+const grantRoleSQL = `GRANT ROLE %s TO %s`
+
+const autoActivateRolesSQL = `ALTER LOGIN %s ADD AUTO ACTIVATED ROLES %s`
@@ -0,0 +1,45 @@
+package sybase
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+func TestRoleDocument_Profile(t *testing.T) {
+	role, _, err := parseRoleDocument(dbplugin.Statements{
+		Creation: []string{`{"login_profile": "vault_analysts", "default_roles": ["analyst_role", "report_role"]}`, "CREATE LOGIN {{name}} WITH PASSWORD {{password}}", `{{range $r := databases}}USE {{$r}}; sp_adduser {{name}}{{end}}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.LoginProfile != "vault_analysts" || len(role.DefaultRoles) != 2 || !role.loginOptions() {
+		t.Fatalf("unexpected role: %#v", role)
+	}
+
+	for _, doc := range []string{
+		`{"login_profile": "vault analysts"}`,
+		`{"default_roles": ["analyst_role", "sa_role, sso_role"]}`,
+	} {
+		if _, _, err := parseRoleDocument(dbplugin.Statements{Creation: []string{doc, "sp_addlogin {{name}}, {{password}}"}}); err == nil {
+			t.Fatalf("expected an error for %s", doc)
+		}
+	}
+}
+
+func TestSYBASE_ApplyProfileVersion(t *testing.T) {
+	db := newFakeSYBASE()
+	ctx := context.Background()
+	if _, err := db.Init(ctx, map[string]interface{}{"connection_url": "Server=profile"}, false); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.capabilities = &Capabilities{VersionNumber: 15500, Dialect: dialectLegacy}
+
+	err := db.applyLoginOptions(ctx, &roleDocument{LoginProfile: "vault_analysts"}, "v_test", dbplugin.UsernameConfig{})
+	if err == nil || !strings.Contains(err.Error(), "ASE 15.7") {
+		t.Fatalf("expected an error for an old server, got %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+package sybase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/api"
+)
+
+// Lease is a database credential lease, as reported by Vault.
+type Lease struct {
+	ID        string    `json:"id"`
+	Role      string    `json:"role"`
+	IssueTime time.Time `json:"issue_time"`
+}
+
+// ReconcileOptions configures a reconciliation of managed logins against
+// Vault's leases.
+type ReconcileOptions struct {
+	// Mount is the path the database secrets engine is mounted at.
+	Mount string
+
+	// Tolerance is the largest difference between a lease's issue time and
+	// a login's creation time for the two to be matched.
+	Tolerance time.Duration
+
+	// RevokeLogins drops logins that have no lease.
+	RevokeLogins bool
+
+	// RevokeLeases force-revokes leases that have no login.
+	RevokeLeases bool
+
+	// DryRun reports what RevokeLogins and RevokeLeases would do without
+	// doing it.
+	DryRun bool
+}
+
+// ReconcileReport is the outcome of a reconciliation.
+type ReconcileReport struct {
+	DryRun             bool           `json:"dry_run"`
+	Matched            int            `json:"matched"`
+	LoginsWithoutLease []ManagedLogin `json:"logins_without_lease"`
+	LeasesWithoutLogin []Lease        `json:"leases_without_login"`
+
+	// SkippedLogins and SkippedLeases are unmatched, but never revoked: the
+	// login was created too recently to have had its lease listed, its
+	// creation time comes from pwdate and may be that of a later password
+	// change, or its role has both unmatched logins and leases, which points
+	// to clock skew rather than a lost lease.
+	SkippedLogins []ManagedLogin `json:"skipped_logins,omitempty"`
+	SkippedLeases []Lease        `json:"skipped_leases,omitempty"`
+
+	// OtherLogins is the number of managed logins of roles the mount does
+	// not have, which belong to another mount or Vault cluster.
+	OtherLogins int `json:"other_logins"`
+
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Reconcile compares the managed logins on the server with the leases Vault
+// holds under the mount, and optionally cleans up either side.
+//
+// Vault does not expose the username behind a lease, so leases and logins
+// are matched by role, as embedded in the username, and by time: a lease
+// matches the login of its role created closest to its issue time, within
+// the tolerance. Only logins of the mount's roles are considered.
+func (m *SYBASE) Reconcile(ctx context.Context, client *api.Client, opts ReconcileOptions) (*ReconcileReport, error) {
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = 2 * time.Minute
+	}
+
+	roles, err := listMountRoles(client, opts.Mount)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := time.Now()
+	leases, err := listMountLeases(client, opts.Mount)
+	if err != nil {
+		return nil, err
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+
+	logins, err := m.ListManagedLogins(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := reconcile(leases, logins, roles, opts.Tolerance, listed)
+	report.DryRun = opts.DryRun
+	if opts.DryRun {
+		return report, nil
+	}
+
+	if opts.RevokeLogins {
+		for _, login := range report.LoginsWithoutLease {
+			if err := m.revokeUserDefault(ctx, login.Name, ""); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("could not drop login %q: %s", login.Name, err))
+				continue
+			}
+			log.Printf("Reconcile: dropped login '%s' without a lease", login.Name)
+		}
+	}
+
+	if opts.RevokeLeases {
+		// The login is already gone, so a normal revocation would fail in
+		// the plugin and leave the lease in place.
+		for _, lease := range report.LeasesWithoutLogin {
+			if err := client.Sys().RevokeForce(lease.ID); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("could not revoke lease %q: %s", lease.ID, err))
+				continue
+			}
+			log.Printf("Reconcile: revoked lease '%s' without a login", lease.ID)
+		}
+	}
+
+	return report, nil
+}
+
+// listMountRoles lists the roles of the mount.
+func listMountRoles(client *api.Client, mount string) ([]string, error) {
+	mount = strings.Trim(mount, "/")
+	if mount == "" {
+		return nil, fmt.Errorf("a mount is required")
+	}
+	return listKeys(client, mount+"/roles")
+}
+
+// listMountLeases lists every credential lease under the mount.
+func listMountLeases(client *api.Client, mount string) ([]Lease, error) {
+	mount = strings.Trim(mount, "/")
+	if mount == "" {
+		return nil, fmt.Errorf("a mount is required")
+	}
+
+	prefix := mount + "/creds/"
+	roles, err := listKeys(client, "sys/leases/lookup/"+prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var leases []Lease
+	for _, role := range roles {
+		role = strings.TrimSuffix(role, "/")
+		ids, err := listKeys(client, "sys/leases/lookup/"+prefix+role+"/")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range ids {
+			lease := Lease{
+				ID:   prefix + role + "/" + id,
+				Role: role,
+			}
+
+			secret, err := client.Logical().Write("sys/leases/lookup", map[string]interface{}{
+				"lease_id": lease.ID,
+			})
+			if err != nil {
+				// Revoked between the list and the lookup
+				if strings.Contains(err.Error(), "invalid lease") {
+					continue
+				}
+				return nil, errwrap.Wrapf(fmt.Sprintf("could not look up lease %q: {{err}}", lease.ID), err)
+			}
+			if secret == nil {
+				continue
+			}
+
+			issueTime, _ := secret.Data["issue_time"].(string)
+			if lease.IssueTime, err = time.Parse(time.RFC3339Nano, issueTime); err != nil {
+				return nil, errwrap.Wrapf(fmt.Sprintf("invalid issue time for lease %q: {{err}}", lease.ID), err)
+			}
+			leases = append(leases, lease)
+		}
+	}
+
+	return leases, nil
+}
+
+func listKeys(client *api.Client, path string) ([]string, error) {
+	secret, err := client.Logical().List(path)
+	if err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("could not list %q: {{err}}", path), err)
+	}
+	if secret == nil {
+		return nil, nil
+	}
+
+	raw, _ := secret.Data["keys"].([]interface{})
+	keys := make([]string, 0, len(raw))
+	for _, k := range raw {
+		if s, ok := k.(string); ok {
+			keys = append(keys, s)
+		}
+	}
+	return keys, nil
+}
+
+// reconcile matches leases with the logins of the mount's roles. Leases are
+// matched in order of issue time, each to the closest unmatched login of its
+// role within tolerance. Leases were listed at listed.
+func reconcile(leases []Lease, allLogins []ManagedLogin, roles []string, tolerance time.Duration, listed time.Time) *ReconcileReport {
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].IssueTime.Before(leases[j].IssueTime)
+	})
+
+	report := &ReconcileReport{}
+	var logins []ManagedLogin
+	for _, login := range allLogins {
+		if len(loginRoles(login.Name, roles)) == 0 {
+			report.OtherLogins++
+			continue
+		}
+		logins = append(logins, login)
+	}
+
+	matched := make([]bool, len(logins))
+	var unmatchedLeases []Lease
+	for _, lease := range leases {
+		best := -1
+		var bestDiff time.Duration
+		for i, login := range logins {
+			if matched[i] || !loginHasRole(login.Name, lease.Role) {
+				continue
+			}
+
+			diff := lease.IssueTime.Sub(login.Created)
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff <= tolerance && (best < 0 || diff < bestDiff) {
+				best, bestDiff = i, diff
+			}
+		}
+
+		if best < 0 {
+			unmatchedLeases = append(unmatchedLeases, lease)
+			continue
+		}
+		matched[best] = true
+		report.Matched++
+	}
+
+	// A role with both unmatched logins and leases most likely has them
+	// apart by more than the tolerance, so neither side is revoked
+	skewed := map[string]bool{}
+	for _, lease := range unmatchedLeases {
+		for i, login := range logins {
+			if !matched[i] && loginHasRole(login.Name, lease.Role) {
+				skewed[lease.Role] = true
+			}
+		}
+	}
+
+	for _, lease := range unmatchedLeases {
+		if skewed[lease.Role] {
+			report.SkippedLeases = append(report.SkippedLeases, lease)
+			continue
+		}
+		report.LeasesWithoutLogin = append(report.LeasesWithoutLogin, lease)
+	}
+
+	for i, login := range logins {
+		if matched[i] {
+			continue
+		}
+
+		skip := login.Created.After(listed.Add(-tolerance)) || login.CreatedSource == createdSourcePwdate
+		for _, role := range loginRoles(login.Name, roles) {
+			skip = skip || skewed[role]
+		}
+
+		if skip {
+			report.SkippedLogins = append(report.SkippedLogins, login)
+			continue
+		}
+		report.LoginsWithoutLease = append(report.LoginsWithoutLease, login)
+	}
+	return report
+}
+
+// loginRoles returns the roles a generated username could belong to.
+func loginRoles(username string, roles []string) []string {
+	var result []string
+	for _, role := range roles {
+		if loginHasRole(username, role) {
+			result = append(result, role)
+		}
+	}
+	return result
+}
+
+// loginHasRole reports whether a generated username could belong to the
+// role, allowing for the generator truncating the role name to 20
+// characters and the whole username to 30.
+func loginHasRole(username, role string) bool {
+	if len(role) > 20 {
+		role = role[:20]
+	}
+
+	parts := strings.Split(username, "_")
+	for i := 1; i < len(parts); i++ {
+		candidate := strings.Join(parts[i:], "_")
+		if strings.HasPrefix(candidate, role+"_") {
+			return true
+		}
+		// The username was cut off inside the role name
+		if len(username) >= 30 && candidate != "" && strings.HasPrefix(role, candidate) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package sybase
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestListMountLeases(t *testing.T) {
+	issued := time.Date(2018, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/sys/leases/lookup/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("list") != "true" {
+			t.Errorf("expected a list request, got %s", r.URL)
+		}
+		switch strings.TrimSuffix(r.URL.Path, "/") {
+		case "/v1/sys/leases/lookup/sybase/creds":
+			writeData(w, map[string]interface{}{"keys": []string{"test/"}})
+		case "/v1/sys/leases/lookup/sybase/creds/test":
+			writeData(w, map[string]interface{}{"keys": []string{"abc", "gone"}})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/v1/sys/leases/lookup", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("err: %s", err)
+		}
+		if body["lease_id"] != "sybase/creds/test/abc" {
+			// What Vault returns for a lease revoked since it was listed
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"invalid lease"}})
+			return
+		}
+		writeData(w, map[string]interface{}{
+			"id":         body["lease_id"],
+			"issue_time": issued.Format(time.RFC3339Nano),
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	leases, err := listMountLeases(client, "/sybase/")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(leases) != 1 {
+		t.Fatalf("expected 1 lease, got %#v", leases)
+	}
+	if leases[0].ID != "sybase/creds/test/abc" || leases[0].Role != "test" || !leases[0].IssueTime.Equal(issued) {
+		t.Fatalf("unexpected lease: %#v", leases[0])
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	now := time.Now()
+	leases := []Lease{
+		{ID: "sybase/creds/test/a", Role: "test", IssueTime: now},
+		{ID: "sybase/creds/test/b", Role: "test", IssueTime: now.Add(-time.Hour)},
+		{ID: "sybase/creds/reporting/c", Role: "reporting", IssueTime: now},
+	}
+	logins := []ManagedLogin{
+		{Name: "v_root_test_4qvNqxvgHfsiEpQGXS", Created: now.Add(-10 * time.Second)},
+		{Name: "v_root_test_Zm9vYmFyYmF6cXV4eA", Created: now.Add(-time.Hour)},
+		{Name: "v_root_other_Zm9vYmFyYmF6cXV4", Created: now},
+		{Name: "v_averyveryverylongdisplay_rep", Created: now.Add(time.Second)},
+	}
+
+	listed := now.Add(time.Hour)
+	roles := []string{"test", "reporting", "other"}
+
+	report := reconcile(leases, logins, roles, time.Minute, listed)
+	if report.Matched != 3 {
+		t.Fatalf("expected 3 matches, got %#v", report)
+	}
+	if len(report.LeasesWithoutLogin) != 0 {
+		t.Fatalf("unexpected leases without login: %#v", report.LeasesWithoutLogin)
+	}
+	if len(report.LoginsWithoutLease) != 1 || report.LoginsWithoutLease[0].Name != "v_root_other_Zm9vYmFyYmF6cXV4" {
+		t.Fatalf("unexpected logins without lease: %#v", report.LoginsWithoutLease)
+	}
+
+	// Logins of roles the mount does not have are left alone
+	report = reconcile(leases, logins, roles[:2], time.Minute, listed)
+	if report.OtherLogins != 1 || len(report.LoginsWithoutLease) != 0 {
+		t.Fatalf("expected the login of another mount to be ignored, got %#v", report)
+	}
+
+	report = reconcile(leases, nil, roles, time.Minute, listed)
+	if len(report.LeasesWithoutLogin) != 3 {
+		t.Fatalf("expected all leases without login, got %#v", report)
+	}
+}
+
+func TestReconcile_Skipped(t *testing.T) {
+	now := time.Now()
+	roles := []string{"test", "other"}
+
+	// A login and a lease of the same role further apart than the tolerance
+	leases := []Lease{{ID: "sybase/creds/test/a", Role: "test", IssueTime: now}}
+	logins := []ManagedLogin{{Name: "v_root_test_4qvNqxvgHfsiEpQGXS", Created: now.Add(-time.Hour)}}
+	report := reconcile(leases, logins, roles, time.Minute, now)
+	if len(report.SkippedLeases) != 1 || len(report.SkippedLogins) != 1 {
+		t.Fatalf("expected the skewed lease and login to be skipped, got %#v", report)
+	}
+	if len(report.LeasesWithoutLogin) != 0 || len(report.LoginsWithoutLease) != 0 {
+		t.Fatalf("expected nothing to revoke, got %#v", report)
+	}
+
+	// A login created after the leases were listed
+	logins = []ManagedLogin{{Name: "v_root_other_Zm9vYmFyYmF6cXV4", Created: now.Add(time.Second)}}
+	report = reconcile(nil, logins, roles, time.Minute, now)
+	if len(report.SkippedLogins) != 1 || len(report.LoginsWithoutLease) != 0 {
+		t.Fatalf("expected the recent login to be skipped, got %#v", report)
+	}
+}
+
+func TestReconcile_Pwdate(t *testing.T) {
+	now := time.Now()
+	roles := []string{"test", "reporting"}
+	matched, rotated, orphaned := generateUsername(t, "root", "test"), generateUsername(t, "root", "test"), generateUsername(t, "root", "reporting")
+
+	leases := []Lease{
+		{ID: "sybase/creds/test/a", Role: "test", IssueTime: now.Add(-3 * time.Hour)},
+		{ID: "sybase/creds/test/b", Role: "test", IssueTime: now.Add(-2 * time.Hour)},
+	}
+	logins := []ManagedLogin{
+		{Name: matched, Created: now.Add(-3 * time.Hour), CreatedSource: createdSourcePwdate},
+		// Created with lease b, its password changed an hour later
+		{Name: rotated, Created: now.Add(-time.Hour), CreatedSource: createdSourcePwdate},
+		{Name: orphaned, Created: now.Add(-5 * time.Hour), CreatedSource: createdSourcePwdate},
+	}
+
+	report := reconcile(leases, logins, roles, time.Minute, now)
+	if report.Matched != 1 {
+		t.Fatalf("expected 1 match, got %#v", report)
+	}
+	if len(report.LoginsWithoutLease) != 0 || len(report.LeasesWithoutLogin) != 0 {
+		t.Fatalf("expected nothing to revoke, got %#v", report)
+	}
+	if len(report.SkippedLogins) != 2 || len(report.SkippedLeases) != 1 || report.SkippedLeases[0].ID != "sybase/creds/test/b" {
+		t.Fatalf("expected the rotated login, its lease and the login without a lease to be skipped, got %#v", report)
+	}
+}
+
+func writeData(w http.ResponseWriter, data map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
@@ -0,0 +1,251 @@
+package sybase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+// Provisioning modes of a role.
+const (
+	provisioningStatements      = "statements"
+	provisioningStoredProcedure = "stored_procedure"
+	provisioningGrants          = "grants"
+)
+
+// roleDocument holds role-level options. It is given as a JSON object in
+// place of one of the role's creation statements; a T-SQL batch never starts
+// with "{", so it cannot be mistaken for one. Vault passes all of a role's
+// statements to every operation, so the options are also available when
+// renewing and revoking.
+type roleDocument struct {
+	// Provisioning is "statements", the default, to run the role's
+	// statements, "stored_procedure" to call Procedures instead, or
+	// "grants" to run the statements compiled from Grants.
+	Provisioning string          `json:"provisioning"`
+	Procedures   roleProcedures  `json:"procedures"`
+	Grants       *grantsDocument `json:"grants"`
+
+	// ResourceLimits are attached to each login after it is created and
+	// removed when it is revoked. TimeRanges are created for them as needed.
+	ResourceLimits []resourceLimit `json:"resource_limits"`
+	TimeRanges     []timeRange     `json:"time_ranges"`
+
+	// ExecClass and TempdbGroup are the execution class and tempdb group
+	// each login is bound to.
+	ExecClass   string `json:"exec_class"`
+	TempdbGroup string `json:"tempdb_group"`
+
+	// LoginProfile is the login profile assigned to each login, and
+	// DefaultRoles the roles granted to it and activated at login.
+	LoginProfile string   `json:"login_profile"`
+	DefaultRoles []string `json:"default_roles"`
+
+	// ExecuteAs is the login the creation and revocation statements run as,
+	// through set proxy, in place of the configured login.
+	ExecuteAs string `json:"execute_as"`
+}
+
+// roleProcedures are the procedures called in stored procedure mode.
+type roleProcedures struct {
+	Create *procedureCall `json:"create"`
+	Renew  *procedureCall `json:"renew"`
+	Revoke *procedureCall `json:"revoke"`
+}
+
+// storedProcedures reports whether the role is provisioned through stored
+// procedures.
+func (d *roleDocument) storedProcedures() bool {
+	return d.Provisioning == provisioningStoredProcedure
+}
+
+// loginOptions reports whether the role has options that are applied to
+// each login after it is created.
+func (d *roleDocument) loginOptions() bool {
+	return len(d.ResourceLimits) > 0 || len(d.TimeRanges) > 0 || d.ExecClass != "" || d.TempdbGroup != "" ||
+		d.LoginProfile != "" || len(d.DefaultRoles) > 0
+}
+
+// parseRoleDocument separates the role document, if any, from the creation
+// statements, returning the remaining creation statements, or those compiled
+// from the grants in "grants" provisioning. A role without a document gets
+// the default options.
+func parseRoleDocument(role dbplugin.Statements) (*roleDocument, []string, error) {
+	doc := &roleDocument{}
+	var creation []string
+	found := false
+
+	for _, stmt := range role.Creation {
+		if !isRoleDocument(stmt) {
+			creation = append(creation, stmt)
+			continue
+		}
+		if found {
+			return nil, nil, errors.New("a role can only have one role document")
+		}
+		found = true
+
+		dec := json.NewDecoder(bytes.NewReader([]byte(stmt)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(doc); err != nil {
+			return nil, nil, errwrap.Wrapf("invalid role document: {{err}}", err)
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return nil, nil, errors.New("invalid role document: unexpected text after the JSON object")
+		}
+	}
+
+	if err := doc.validate(creation, role); err != nil {
+		return nil, nil, err
+	}
+	if doc.Provisioning == provisioningGrants {
+		creation = doc.Grants.statements()
+	}
+	return doc, creation, nil
+}
+
+// isRoleDocument reports whether a creation statement is a role document
+// rather than T-SQL: a JSON object, which opens with "{" followed by a key or
+// "}". Statements opening with a template action such as {{if ...}}, or with
+// an ODBC escape such as {call ...}, are not.
+func isRoleDocument(stmt string) bool {
+	stmt = strings.TrimSpace(stmt)
+	if !strings.HasPrefix(stmt, "{") {
+		return false
+	}
+	rest := strings.TrimSpace(stmt[1:])
+	return strings.HasPrefix(rest, `"`) || strings.HasPrefix(rest, "}")
+}
+
+func (d *roleDocument) validate(creation []string, role dbplugin.Statements) error {
+	switch d.Provisioning {
+	case "":
+		d.Provisioning = provisioningStatements
+	case provisioningStatements, provisioningStoredProcedure, provisioningGrants:
+	default:
+		return fmt.Errorf("invalid provisioning %q, must be %q, %q or %q", d.Provisioning, provisioningStatements, provisioningStoredProcedure, provisioningGrants)
+	}
+
+	if d.Provisioning == provisioningGrants {
+		if d.Grants == nil {
+			return fmt.Errorf("%q provisioning requires grants", provisioningGrants)
+		}
+		// The revocation is the default one
+		if len(creation) > 0 || len(role.Revocation) > 0 {
+			return fmt.Errorf("creation and revocation statements cannot be combined with %q provisioning", provisioningGrants)
+		}
+		if err := d.Grants.validate(); err != nil {
+			return err
+		}
+	} else if d.Grants != nil {
+		return fmt.Errorf("grants require %q provisioning", provisioningGrants)
+	}
+
+	if d.ExecuteAs != "" && !identifierRegex.MatchString(d.ExecuteAs) {
+		return fmt.Errorf("invalid execute_as login %q", d.ExecuteAs)
+	}
+
+	if d.LoginProfile != "" && !identifierRegex.MatchString(d.LoginProfile) {
+		return fmt.Errorf("invalid login_profile %q", d.LoginProfile)
+	}
+	for _, r := range d.DefaultRoles {
+		if !identifierRegex.MatchString(r) {
+			return fmt.Errorf("invalid default role %q", r)
+		}
+	}
+
+	for i := range d.ResourceLimits {
+		if err := d.ResourceLimits[i].validate(); err != nil {
+			return err
+		}
+	}
+	for i := range d.TimeRanges {
+		if err := d.TimeRanges[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	if !d.storedProcedures() {
+		if d.Procedures != (roleProcedures{}) {
+			return fmt.Errorf("procedures require %q provisioning", provisioningStoredProcedure)
+		}
+		return nil
+	}
+
+	if len(creation) > 0 || len(role.Renewal) > 0 || len(role.Revocation) > 0 {
+		return fmt.Errorf("statements cannot be combined with %q provisioning", provisioningStoredProcedure)
+	}
+	if d.ExecuteAs != "" {
+		return fmt.Errorf("execute_as cannot be combined with %q provisioning", provisioningStoredProcedure)
+	}
+	if d.Procedures.Create == nil || d.Procedures.Revoke == nil {
+		return fmt.Errorf("%q provisioning requires create and revoke procedures", provisioningStoredProcedure)
+	}
+	for _, call := range []*procedureCall{d.Procedures.Create, d.Procedures.Renew, d.Procedures.Revoke} {
+		if call == nil {
+			continue
+		}
+		if err := call.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyLoginOptions applies the role's options, and the auditing set up in
+// the connection configuration, to a newly created login.
+func (m *SYBASE) applyLoginOptions(ctx context.Context, role *roleDocument, username string, usernameConfig dbplugin.UsernameConfig) error {
+	audit := m.auditOptions()
+	if !role.loginOptions() && len(audit) == 0 {
+		return nil
+	}
+
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	sess, err := newSession(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer sess.close(ctx)
+
+	if err := m.applyProfile(ctx, sess, role, username); err != nil {
+		return err
+	}
+	if err := sess.applyResourceLimits(ctx, role, username); err != nil {
+		return err
+	}
+	if err := sess.bindLogin(ctx, role, username); err != nil {
+		return err
+	}
+	if len(audit) > 0 {
+		return sess.enableAudit(ctx, username, audit, auditFullname(usernameConfig))
+	}
+	return nil
+}
+
+// removeLoginOptions removes whatever options the login has, whether or not
+// its role still sets them, and turns off its auditing. It has to run before
+// the login is dropped, as ASE leaves the resource limits and bindings of a
+// dropped login behind.
+func (m *SYBASE) removeLoginOptions(ctx context.Context, sess *session, username string) error {
+	if err := sess.dropResourceLimits(ctx, username); err != nil {
+		return err
+	}
+	if err := sess.unbindLogin(ctx, username); err != nil {
+		return err
+	}
+	if audit := m.auditOptions(); len(audit) > 0 {
+		return sess.disableAudit(ctx, username, audit)
+	}
+	return nil
+}
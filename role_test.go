@@ -0,0 +1,268 @@
+package sybase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+const testProcedureRole = `{
+  "provisioning": "stored_procedure",
+  "procedures": {
+    "create": {
+      "name": "dba..vault_create_login",
+      "params": [
+        {"name": "@name", "value": "{{name}}"},
+        {"name": "@password", "value": "{{password}}"},
+        {"name": "@days", "type": "int", "value": "{{expiration_days}}"},
+        {"name": "@login_id", "type": "int", "output": true}
+      ]
+    },
+    "revoke": {"name": "dba..vault_drop_login", "params": [{"name": "@name", "value": "{{name}}"}]}
+  }
+}`
+
+func TestParseRoleDocument(t *testing.T) {
+	role, creation, err := parseRoleDocument(dbplugin.Statements{
+		Creation: []string{"sp_addlogin {{name}}, {{password}}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.storedProcedures() || len(creation) != 1 {
+		t.Fatalf("unexpected role: %#v, %v", role, creation)
+	}
+
+	role, creation, err = parseRoleDocument(dbplugin.Statements{Creation: []string{testProcedureRole}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !role.storedProcedures() || len(creation) != 0 {
+		t.Fatalf("unexpected role: %#v, %v", role, creation)
+	}
+	if role.Procedures.Create.Name != "dba..vault_create_login" || role.Procedures.Renew != nil {
+		t.Fatalf("unexpected procedures: %#v", role.Procedures)
+	}
+
+	for name, statements := range map[string]dbplugin.Statements{
+		"unknown field":      {Creation: []string{`{"provisioning": "stored_procedure", "procedure": {}}`}},
+		"invalid mode":       {Creation: []string{`{"provisioning": "magic"}`}},
+		"missing revoke":     {Creation: []string{`{"provisioning": "stored_procedure", "procedures": {"create": {"name": "p"}}}`}},
+		"mixed statements":   {Creation: []string{testProcedureRole}, Revocation: []string{"sp_droplogin {{name}}"}},
+		"procedures unused":  {Creation: []string{`{"procedures": {"create": {"name": "p"}}}`, "sp_addlogin {{name}}"}},
+		"invalid param type": {Creation: []string{`{"provisioning": "stored_procedure", "procedures": {"create": {"name": "p", "params": [{"name": "@a", "type": "blob"}]}, "revoke": {"name": "p"}}}`}},
+		"two role documents": {Creation: []string{`{}`, `{}`}},
+		"invalid json":       {Creation: []string{`{"provisioning": `}},
+		"invalid name":       {Creation: []string{`{"provisioning": "stored_procedure", "procedures": {"create": {"name": "p; DROP LOGIN sa"}, "revoke": {"name": "p"}}}`}},
+		"trailing text":      {Creation: []string{`{"provisioning": "statements"} sp_addlogin {{name}}`}},
+	} {
+		if _, _, err := parseRoleDocument(statements); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseRoleDocument_TemplatedStatements(t *testing.T) {
+	templated := []string{
+		`{{if eq .display_name "batch"}}sp_addlogin {{name}}, {{password}}, batch{{else}}sp_addlogin {{name}}, {{password}}{{end}}`,
+		"{{range $db := databases}}USE {{$db}}\ngo\nsp_adduser {{name}}\ngo\n{{end}}",
+		` {{grant_all "select" "U" "dbo"}}`,
+		"{call dba..vault_create_login}",
+	}
+	for _, stmt := range templated {
+		role, creation, err := parseRoleDocument(dbplugin.Statements{Creation: []string{stmt}})
+		if err != nil {
+			t.Fatalf("%q: %s", stmt, err)
+		}
+		if role.Provisioning != provisioningStatements || len(creation) != 1 || creation[0] != stmt {
+			t.Fatalf("%q: expected a plain statement, got %#v, %q", stmt, role, creation)
+		}
+	}
+
+	// Alongside a role document
+	_, creation, err := parseRoleDocument(dbplugin.Statements{Creation: append([]string{`{ "exec_class": "EC3" }`}, templated...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creation) != len(templated) {
+		t.Fatalf("expected %d statements, got %q", len(templated), creation)
+	}
+}
+
+func TestProcedureCall_Args(t *testing.T) {
+	role, _, err := parseRoleDocument(dbplugin.Statements{Creation: []string{testProcedureRole}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := role.Procedures.Create.args(templateVarsFor(nil, map[string]interface{}{
+		"name":     "v_root_test",
+		"password": `it's "secret"`,
+	}, expirationVars(time.Now().Add(48*time.Hour), "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if args[0] != "v_root_test" || args[1] != `it's "secret"` {
+		t.Fatalf("expected values to be passed without escaping: %#v", args)
+	}
+	if args[2] != int64(2) {
+		t.Fatalf("expected an int parameter: %#v", args[2])
+	}
+	if args[3] != nil {
+		t.Fatalf("expected a NULL output parameter: %#v", args[3])
+	}
+
+	expected := `DECLARE @vault_status int, @vault_output1 int
+EXEC @vault_status = dba..vault_create_login 'v_root_test', 'it''s "secret"', 2, @vault_output1 OUTPUT
+IF @vault_status != 0
+  RAISERROR 17001 'procedure dba..vault_create_login returned status %1!', @vault_status
+SELECT 'vault_outputs' AS vault_outputs, @vault_output1`
+	if query := role.Procedures.Create.procedureQuery(args); query != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, query)
+	}
+
+	if _, err := convertParam(paramTypeDatetime, "2018-10-19 01:02:03"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The expiration variable renders with a UTC offset
+	expiration := time.Date(2018, 10, 19, 1, 2, 3, 0, time.FixedZone("", -5*3600))
+	expirationStr, err := new().GenerateExpiration(expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := &procedureCall{Name: "vault_expire", Params: []procedureParam{{Name: "@expires", Type: paramTypeDatetime, Value: "{{expiration}}"}}}
+	args, err = call.args(expirationVars(expiration, expirationStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if literal := sqlLiteral(args[0]); literal != "'2018-10-19 01:02:03'" {
+		t.Fatalf("unexpected datetime literal %s", literal)
+	}
+	if _, err := convertParam(paramTypeInt, "many"); err == nil {
+		t.Fatal("expected an error converting to int")
+	}
+}
+
+func TestSYBASE_ExecProcedure(t *testing.T) {
+	role, _, err := parseRoleDocument(dbplugin.Statements{Creation: []string{testProcedureRole}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := templateVarsFor(nil, map[string]interface{}{"name": "v_root_test", "password": "secret"}, expirationVars(time.Now(), ""))
+
+	for server, fail := range map[string]bool{
+		"procedure":            false,
+		"procedure-fail":       true,
+		"procedure-results":    false,
+		"procedure-first-only": true,
+	} {
+		db := newFakeSYBASE()
+		ctx := context.Background()
+		if _, err := db.Init(ctx, map[string]interface{}{"connection_url": "Server=" + server}, false); err != nil {
+			t.Fatal(err)
+		}
+
+		err := db.execProcedure(ctx, role.Procedures.Create, vars)
+		if (err != nil) != fail {
+			t.Fatalf("%s: unexpected error %v", server, err)
+		}
+		if err != nil && strings.Contains(err.Error(), "secret") {
+			t.Fatalf("expected the password to be redacted: %s", err)
+		}
+		if server == "procedure-first-only" && !strings.Contains(err.Error(), "output parameters could not be read") {
+			t.Fatalf("expected lost output parameters to be an error, got %s", err)
+		}
+		db.Close()
+		if testFakeDriver.openConnections("Server="+server) != 0 {
+			t.Fatalf("%s: expected the pool to be closed", server)
+		}
+	}
+}
+
+func TestRoleDocument_Bindings(t *testing.T) {
+	role, _, err := parseRoleDocument(dbplugin.Statements{
+		Creation: []string{`{"exec_class": "EC3", "tempdb_group": "batch_tempdbs"}`, "sp_addlogin {{name}}, {{password}}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.ExecClass != "EC3" || role.TempdbGroup != "batch_tempdbs" || !role.loginOptions() {
+		t.Fatalf("unexpected role: %#v", role)
+	}
+
+	// Predefined classes and groups are not looked up
+	if err := checkExecClass(context.Background(), nil, "ec1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkTempdbGroup(context.Background(), nil, defaultTempdbGroup); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSYBASE_CreateUserChecksBindings(t *testing.T) {
+	db := newFakeSYBASE()
+	ctx := context.Background()
+	// Every statement fails on this server, so an error about the class
+	// means the login was never created
+	if _, err := db.Init(ctx, map[string]interface{}{"connection_url": "Server=bindings-fail"}, false); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	statements := dbplugin.Statements{
+		Creation: []string{`{"exec_class": "EC_batch"}`, "sp_addlogin {{name}}, {{password}}"},
+	}
+	_, _, err := db.CreateUser(ctx, statements, dbplugin.UsernameConfig{DisplayName: "test", RoleName: "test"}, time.Now().Add(time.Hour))
+	if err == nil || !strings.Contains(err.Error(), `execution class "EC_batch" does not exist`) {
+		t.Fatalf("expected the missing execution class to fail creation up front, got %v", err)
+	}
+}
+
+func TestRoleDocument_ExecuteAs(t *testing.T) {
+	role, _, err := parseRoleDocument(dbplugin.Statements{
+		Creation: []string{`{"execute_as": "vault_sales_admin"}`, "sp_addlogin {{name}}, {{password}}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.ExecuteAs != "vault_sales_admin" {
+		t.Fatalf("unexpected role: %#v", role)
+	}
+
+	for _, doc := range []string{
+		`{"execute_as": "sa; DROP LOGIN vault"}`,
+		`{"execute_as": "vault_admin", "provisioning": "stored_procedure", "procedures": {"create": {"name": "p"}, "revoke": {"name": "p"}}}`,
+	} {
+		if _, _, err := parseRoleDocument(dbplugin.Statements{Creation: []string{doc}}); err == nil {
+			t.Fatalf("expected an error for %s", doc)
+		}
+	}
+
+	db := newFakeSYBASE()
+	ctx := context.Background()
+	if _, err := db.Init(ctx, map[string]interface{}{"connection_url": "Server=execute-as"}, false); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conn, err := db.getConnection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := db.newRoleSession(ctx, conn, "vault_sales_admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.originalLogin == "" {
+		t.Fatal("expected the original login to be recorded")
+	}
+	sess.close(ctx)
+	if sess.discarded {
+		t.Fatal("expected the connection to be returned to the pool")
+	}
+}
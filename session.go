@@ -0,0 +1,221 @@
+package sybase
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// session pins a single pooled connection for the duration of one plugin
+// operation. Statements such as "USE vault" change the current database of
+// the connection they run on, so every statement of a CreateUser, RevokeUser
+// or rotation has to run on the same connection, and the connection has to
+// be put back the way it was found before it returns to the pool.
+type session struct {
+	conn      *sql.Conn
+	original  sessionOptions
+	discarded bool
+
+	// unrestorable is set once a statement of the session has changed an
+	// option that cannot be read back, see trackOptions.
+	unrestorable bool
+
+	// originalLogin is set while the session executes as another login.
+	originalLogin string
+}
+
+// sessionOptions are the settings of a connection that a session restores
+// when it is closed.
+type sessionOptions struct {
+	database  string
+	chained   bool
+	rowcount  int
+	isolation int
+	textsize  int
+}
+
+// resetSQL returns the batch that puts a connection back to these options.
+func (o sessionOptions) resetSQL() string {
+	chained := "off"
+	if o.chained {
+		chained = "on"
+	}
+	return fmt.Sprintf(resetSessionSQL, o.database, chained, o.rowcount, o.isolation, o.textsize)
+}
+
+// newSession checks out a dedicated connection from the pool and records the
+// database and options it is currently using.
+func newSession(ctx context.Context, db *sql.DB) (*session, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, errwrap.Wrapf("could not check out connection: {{err}}", err)
+	}
+
+	var original sessionOptions
+	var chained int
+	if err := conn.QueryRowContext(ctx, sessionOptionsSQL).Scan(&original.database, &chained, &original.rowcount, &original.isolation, &original.textsize); err != nil {
+		conn.Close()
+		return nil, errwrap.Wrapf("could not determine session options: {{err}}", err)
+	}
+	original.chained = chained != 0
+
+	return &session{
+		conn:     conn,
+		original: original,
+	}, nil
+}
+
+// executeAs switches the session to another login with set proxy, until the
+// session is closed.
+func (s *session) executeAs(ctx context.Context, login string) error {
+	var original string
+	if err := s.conn.QueryRowContext(ctx, currentLoginSQL).Scan(&original); err != nil {
+		return errwrap.Wrapf("could not determine current login: {{err}}", err)
+	}
+	// set proxy takes a bare login name
+	if !identifierRegex.MatchString(original) {
+		return fmt.Errorf("cannot execute as %s, login %q could not be restored afterwards", login, original)
+	}
+
+	if err := s.execQuery(ctx, fmt.Sprintf(setProxySQL, login)); err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("could not execute as %s: {{err}}", login), err)
+	}
+	s.originalLogin = original
+	return nil
+}
+
+// execStatements renders each statement template with vars, splits the
+// result into batches and executes them in order on the pinned connection.
+func (s *session) execStatements(ctx context.Context, statements []string, vars map[string]interface{}) error {
+	return s.execRendered(ctx, statements, vars, false)
+}
+
+// execCreationStatements is execStatements for creation statements, in which
+// grant_all calls are expanded with the objects on this connection.
+func (s *session) execCreationStatements(ctx context.Context, statements []string, vars map[string]interface{}) error {
+	return s.execRendered(ctx, statements, vars, true)
+}
+
+func (s *session) execRendered(ctx context.Context, statements []string, vars map[string]interface{}, creation bool) error {
+	render := renderStatement
+	if creation {
+		render = creationRenderer(s.grantAllObjects(ctx))
+	}
+
+	for _, stmt := range statements {
+		rendered, err := render(stmt, vars)
+		if err != nil {
+			return err
+		}
+
+		for _, query := range splitStatements(rendered) {
+			s.trackOptions(query)
+			if err := s.execQuery(ctx, query); err != nil {
+				return redactError(err, secretValues(vars))
+			}
+		}
+	}
+	return nil
+}
+
+// trackOptions marks the session as unrestorable if query sets an option
+// whose value ASE does not expose, such as nocount or quoted_identifier.
+// Only the options in sessionOptions can be read when the session opens, so
+// a connection whose other options were changed is discarded on close rather
+// than returned to the pool with a guessed value.
+func (s *session) trackOptions(query string) {
+	for _, match := range setOptionRegex.FindAllStringSubmatch(query, -1) {
+		if match[2] == "" && !restorableOptions[strings.ToLower(match[1])] {
+			s.unrestorable = true
+			return
+		}
+	}
+}
+
+// execQuery executes a single batch on the pinned connection. Errors carrying
+// server messages are returned as a *ServerError.
+func (s *session) execQuery(ctx context.Context, query string) error {
+	stmt, err := s.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return newServerError(err)
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return newServerError(err)
+	}
+	return nil
+}
+
+// close restores the original login, database and session options and returns the
+// connection to the pool. If the connection cannot be reset it is discarded
+// instead, so that no later operation inherits its state.
+func (s *session) close(ctx context.Context) {
+	// The original login is restored first, as the proxied one may not be
+	// able to use the original database
+	if !s.discarded && s.originalLogin != "" {
+		if _, err := s.conn.ExecContext(ctx, fmt.Sprintf(setProxySQL, s.originalLogin)); err != nil {
+			log.Printf("Could not restore login, discarding connection: %s", err)
+			s.discard()
+		}
+	}
+
+	if !s.discarded && s.unrestorable {
+		log.Printf("Session changed options that cannot be restored, discarding connection")
+		s.discard()
+	}
+
+	if !s.discarded {
+		if _, err := s.conn.ExecContext(ctx, s.original.resetSQL()); err != nil {
+			log.Printf("Could not reset session, discarding connection: %s", err)
+			s.discard()
+		}
+	}
+
+	s.conn.Close()
+}
+
+// discard marks the connection as unusable so that it is closed rather than
+// returned to the pool.
+func (s *session) discard() {
+	if s.discarded {
+		return
+	}
+	s.discarded = true
+	s.conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+}
+
+const sessionOptionsSQL = `SELECT db_name(), @@tranchained, @@setrowcount, @@isolation, @@textsize`
+
+const currentLoginSQL = `SELECT suser_name()`
+
+const setProxySQL = `set proxy %s`
+
+const resetSessionSQL = `
+USE %s
+set chained %s
+set rowcount %d
+set transaction isolation level %d
+set textsize %d
+`
+
+// setOptionRegex matches set statements at the start of a line or after a
+// semicolon. The second group is only non-empty for the SET clause of an
+// UPDATE, which assigns a column rather than an option.
+var setOptionRegex = regexp.MustCompile(`(?im)(?:^|;)\s*set\s+([a-z_]+)(\s*=)?`)
+
+// restorableOptions are the options restored from sessionOptions.
+var restorableOptions = map[string]bool{
+	"chained":     true,
+	"rowcount":    true,
+	"transaction": true,
+	"textsize":    true,
+}
@@ -0,0 +1,52 @@
+package sybase
+
+import (
+	"testing"
+)
+
+func TestSessionOptions_ResetSQL(t *testing.T) {
+	options := sessionOptions{
+		database:  "vault",
+		chained:   true,
+		rowcount:  10,
+		isolation: 3,
+		textsize:  65536,
+	}
+
+	expected := `
+USE vault
+set chained on
+set rowcount 10
+set transaction isolation level 3
+set textsize 65536
+`
+	if reset := options.resetSQL(); reset != expected {
+		t.Fatalf("expected %q, got %q", expected, reset)
+	}
+}
+
+func TestSession_TrackOptions(t *testing.T) {
+	type testCase struct {
+		query        string
+		unrestorable bool
+	}
+
+	tests := map[string]testCase{
+		"grant":             {"GRANT select ON t TO v_root", false},
+		"restorable":        {"set chained on\nset rowcount 5; set transaction isolation level 0", false},
+		"update":            {"UPDATE t\nSET nocount = 1", false},
+		"variable":          {"DECLARE @n int\nSET @n = 1", false},
+		"nocount":           {"set nocount on", true},
+		"quoted_identifier": {"GRANT select ON t TO v_root; SET QUOTED_IDENTIFIER ON", true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &session{}
+			s.trackOptions(test.query)
+			if s.unrestorable != test.unrestorable {
+				t.Fatalf("expected unrestorable to be %t", test.unrestorable)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package sybase
+
+import (
+	"strconv"
+	"strings"
+)
+
+// splitStatements breaks a block of T-SQL into the individual batches that
+// are sent to the server. Batches are separated by a semicolon or by a line
+// holding nothing but the "go" keyword, as isql does. Like in isql, "go N"
+// sends the batch before it N times. Separators that appear
+// inside string literals, quoted or bracketed identifiers, or comments are
+// left alone. Empty batches, including ones holding only comments, are
+// dropped.
+func splitStatements(stmt string) []string {
+	var (
+		batches     []string
+		start       int
+		hasContent  bool
+		atLineStart = true
+	)
+
+	emit := func(end, count int) {
+		if hasContent {
+			for n := 0; n < count; n++ {
+				batches = append(batches, strings.TrimSpace(stmt[start:end]))
+			}
+		}
+		hasContent = false
+	}
+
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+
+		switch {
+		case c == '\n':
+			atLineStart = true
+			i++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+
+		case c == '-' && strings.HasPrefix(stmt[i:], "--"):
+			// Line comment, runs up to but not including the newline
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				end = len(stmt) - i
+			}
+			i += end
+
+		case c == '/' && strings.HasPrefix(stmt[i:], "/*"):
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				i = len(stmt)
+			} else {
+				i += end + 4
+			}
+			// A go after a comment on the same line is not a separator
+			atLineStart = false
+
+		case atLineStart && goLineCount(stmt[i:]) > 0:
+			emit(i, goLineCount(stmt[i:]))
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				i = len(stmt)
+			} else {
+				i += end
+			}
+			start = i
+
+		case c == ';':
+			emit(i, 1)
+			i++
+			start = i
+			atLineStart = false
+
+		case c == '\'' || c == '"':
+			i = skipQuoted(stmt, i, c)
+			hasContent = true
+			atLineStart = false
+
+		case c == '[':
+			i = skipQuoted(stmt, i, ']')
+			hasContent = true
+			atLineStart = false
+
+		default:
+			i++
+			hasContent = true
+			atLineStart = false
+		}
+	}
+	emit(len(stmt), 1)
+
+	return batches
+}
+
+// skipQuoted returns the index just past the quoted section that starts at
+// stmt[i]. A doubled closing character is an escaped literal character, not
+// the end of the section. An unterminated section runs to the end of stmt.
+func skipQuoted(stmt string, i int, closing byte) int {
+	for i++; i < len(stmt); i++ {
+		if stmt[i] != closing {
+			continue
+		}
+		if i+1 < len(stmt) && stmt[i+1] == closing {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(stmt)
+}
+
+// goLineCount returns how many times the batch before a "go" separator at the
+// start of s is sent: 1 for a bare "go", N for "go N", and 0 if s does not
+// start with a line holding only a separator. A count that is not a positive
+// number is not a separator, so the line is sent to the server and rejected
+// there.
+func goLineCount(s string) int {
+	if len(s) < 2 || !strings.EqualFold(s[:2], "go") {
+		return 0
+	}
+
+	rest := s[2:]
+	if end := strings.IndexByte(rest, '\n'); end >= 0 {
+		rest = rest[:end]
+	}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return 1
+	}
+	// The count has to be separated from the keyword
+	if !strings.ContainsAny(s[2:3], " \t") {
+		return 0
+	}
+
+	count, err := strconv.Atoi(rest)
+	if err != nil || count < 1 {
+		return 0
+	}
+	return count
+}
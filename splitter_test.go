@@ -0,0 +1,87 @@
+package sybase
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := map[string]struct {
+		stmt     string
+		expected []string
+	}{
+		"semicolons": {
+			stmt:     "USE master; CREATE LOGIN {{name}} WITH PASSWORD {{password}};",
+			expected: []string{"USE master", "CREATE LOGIN {{name}} WITH PASSWORD {{password}}"},
+		},
+		"go lines": {
+			stmt:     "USE vault\ngo\nsp_adduser {{name}}\nGO  \n",
+			expected: []string{"USE vault", "sp_adduser {{name}}"},
+		},
+		"newlines alone do not split": {
+			stmt:     "USE vault\nsp_adduser {{name}}",
+			expected: []string{"USE vault\nsp_adduser {{name}}"},
+		},
+		"go inside identifiers": {
+			stmt:     "grant select on gothic to {{name}}\ngo",
+			expected: []string{"grant select on gothic to {{name}}"},
+		},
+		"single quoted string": {
+			stmt:     "sp_modifylogin {{name}}, fullname, 'a;b'; sp_adduser {{name}}",
+			expected: []string{"sp_modifylogin {{name}}, fullname, 'a;b'", "sp_adduser {{name}}"},
+		},
+		"escaped quote": {
+			stmt:     "select 'it''s; fine'; select 1",
+			expected: []string{"select 'it''s; fine'", "select 1"},
+		},
+		"double quoted identifier": {
+			stmt:     `select * from "odd;name"; select 1`,
+			expected: []string{`select * from "odd;name"`, "select 1"},
+		},
+		"bracketed identifier": {
+			stmt:     "sp_adduser [a;b]; select 1",
+			expected: []string{"sp_adduser [a;b]", "select 1"},
+		},
+		"go inside string": {
+			stmt:     "select 'x\ngo\ny'",
+			expected: []string{"select 'x\ngo\ny'"},
+		},
+		"line comment": {
+			stmt:     "select 1 -- not; a split\nselect 2",
+			expected: []string{"select 1 -- not; a split\nselect 2"},
+		},
+		"block comment": {
+			stmt:     "select 1 /* not; a\ngo\nsplit */; select 2",
+			expected: []string{"select 1 /* not; a\ngo\nsplit */", "select 2"},
+		},
+		"comment only batches are dropped": {
+			stmt:     "-- header\ngo\n/* nothing */;\n;;select 1",
+			expected: []string{"select 1"},
+		},
+		"go after block comment": {
+			stmt:     "select 1\n/* c */go\nselect 2",
+			expected: []string{"select 1\n/* c */go\nselect 2"},
+		},
+		"go with count": {
+			stmt:     "insert into t values (1)\ngo 3\nselect 1\nGO\t2\n",
+			expected: []string{"insert into t values (1)", "insert into t values (1)", "insert into t values (1)", "select 1", "select 1"},
+		},
+		"go with invalid count": {
+			stmt:     "select 1\ngo 0\nselect 2\ngo x\ngo2",
+			expected: []string{"select 1\ngo 0\nselect 2\ngo x\ngo2"},
+		},
+		"empty": {
+			stmt:     " \n\t",
+			expected: nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := splitStatements(test.stmt)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
@@ -24,12 +24,54 @@ type SQLConnectionProducer struct {
 	Username                 string      `json:"username" mapstructure:"username" structs:"username"`
 	Password                 string      `json:"password" mapstructure:"password" structs:"password"`
 
+	// TemplateVars are operator-defined values made available to every
+	// creation, renewal, revocation and rotation statement.
+	TemplateVars map[string]interface{} `json:"template_vars" mapstructure:"template_vars" structs:"template_vars"`
+
+	// Dialect selects the syntax of the default statements: "modern" for
+	// CREATE/ALTER/DROP LOGIN, "legacy" for sp_addlogin and friends, or
+	// "auto", the default, to choose based on the server version.
+	Dialect string `json:"dialect" mapstructure:"dialect" structs:"dialect"`
+
+	// ValidationStatements are validated against the server at Init when the
+	// connection is verified.
+	ValidationStatements validationStatements `json:"validate_statements" mapstructure:"validate_statements" structs:"validate_statements"`
+
+	// StrictPrivilegeCheck fails Init when the login lacks a privilege the
+	// plugin or the statements in validate_statements need, rather than
+	// logging a warning.
+	StrictPrivilegeCheck bool `json:"strict_privilege_check" mapstructure:"strict_privilege_check" structs:"strict_privilege_check"`
+
+	// AuditLogins turns on auditing of every login the plugin creates, with
+	// the sp_audit options in AuditOptions, "all" by default.
+	AuditLogins  bool     `json:"audit_logins" mapstructure:"audit_logins" structs:"audit_logins"`
+	AuditOptions []string `json:"audit_options" mapstructure:"audit_options" structs:"audit_options"`
+
+	// OwnedObjectsPolicy decides what the default revocation does with the
+	// objects a user owns before dropping it: "fail", the default, "drop", or
+	// "transfer_to:<user>".
+	OwnedObjectsPolicy string `json:"owned_objects_policy" mapstructure:"owned_objects_policy" structs:"owned_objects_policy"`
+
+	// TargetServers are additional servers on which every login is created,
+	// renewed and revoked along with this one.
+	TargetServers []targetServer `json:"target_servers" mapstructure:"target_servers" structs:"target_servers"`
+
+	// PasswordExpiryWarningDays is how many days before the configured
+	// login's password expires the plugin starts warning, 14 by default.
+	PasswordExpiryWarningDays int `json:"password_expiry_warning_days" mapstructure:"password_expiry_warning_days" structs:"password_expiry_warning_days"`
+
 	Type                  string
 	RawConfig             map[string]interface{}
 	maxConnectionLifetime time.Duration
 	Initialized           bool
 	db                    *sql.DB
-	sync.Mutex
+
+	// The lock is held exclusively by Init while it swaps configurations, and
+	// for the duration of every operation that uses the pool.
+	sync.RWMutex
+
+	// dbLock guards db, which Connection replaces when the pool goes bad.
+	dbLock sync.Mutex
 }
 
 func (c *SQLConnectionProducer) Initialize(ctx context.Context, conf map[string]interface{}, verifyConnection bool) error {
@@ -37,19 +79,54 @@ func (c *SQLConnectionProducer) Initialize(ctx context.Context, conf map[string]
 	return err
 }
 
+// Init configures the producer. The new configuration is decoded and
+// validated, and its connection verified, on its own before it replaces the
+// current one, so a bad configuration leaves the producer as it was. The
+// swap waits for operations holding the lock to finish, after which the old
+// pool is idle and is closed.
 func (c *SQLConnectionProducer) Init(ctx context.Context, conf map[string]interface{}, verifyConnection bool) (map[string]interface{}, error) {
+	next := &SQLConnectionProducer{Type: c.Type}
+	if err := next.configure(conf); err != nil {
+		return nil, err
+	}
+
+	if verifyConnection {
+		if _, err := next.Connection(ctx); err != nil {
+			return nil, errwrap.Wrapf("error verifying connection: {{err}}", err)
+		}
+
+		if err := next.db.PingContext(ctx); err != nil {
+			next.Close()
+			return nil, errwrap.Wrapf("error verifying connection: {{err}}", err)
+		}
+	}
+
 	c.Lock()
-	defer c.Unlock()
+	old := c.swap(next)
+	c.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
 
+	return next.RawConfig, nil
+}
+
+// configure decodes and validates the configuration into a new producer.
+func (c *SQLConnectionProducer) configure(conf map[string]interface{}) error {
 	c.RawConfig = conf
 
 	err := mapstructure.WeakDecode(conf, &c)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if len(c.ConnectionURL) == 0 {
-		return nil, fmt.Errorf("connection_url cannot be empty")
+		return fmt.Errorf("connection_url cannot be empty")
+	}
+
+	if err := c.migrateEmbeddedCredentials(); err != nil {
+		return err
 	}
 
 	c.ConnectionURL = dbutil.QueryHelper(c.ConnectionURL, map[string]string{
@@ -57,6 +134,30 @@ func (c *SQLConnectionProducer) Init(ctx context.Context, conf map[string]interf
 		"password": c.Password,
 	})
 
+	if err := validateTemplateVars(c.TemplateVars); err != nil {
+		return err
+	}
+
+	if err := validateDialect(c.Dialect); err != nil {
+		return err
+	}
+
+	if err := validateAuditOptions(c.AuditOptions); err != nil {
+		return err
+	}
+
+	if err := validateOwnedObjectsPolicy(c.OwnedObjectsPolicy); err != nil {
+		return err
+	}
+
+	if err := validateTargetServers(c.TargetServers); err != nil {
+		return err
+	}
+
+	if err := validatePasswordExpiryWarningDays(c.PasswordExpiryWarningDays); err != nil {
+		return err
+	}
+
 	if c.MaxOpenConnections == 0 {
 		c.MaxOpenConnections = 2
 	}
@@ -73,24 +174,44 @@ func (c *SQLConnectionProducer) Init(ctx context.Context, conf map[string]interf
 
 	c.maxConnectionLifetime, err = parseutil.ParseDurationSecond(c.MaxConnectionLifetimeRaw)
 	if err != nil {
-		return nil, errwrap.Wrapf("invalid max_connection_lifetime: {{err}}", err)
+		return errwrap.Wrapf("invalid max_connection_lifetime: {{err}}", err)
 	}
 
 	// Set initialized to true at this point since all fields are set,
 	// and the connection can be established at a later time.
 	c.Initialized = true
+	return nil
+}
 
-	if verifyConnection {
-		if _, err := c.Connection(ctx); err != nil {
-			return nil, errwrap.Wrapf("error verifying connection: {{err}}", err)
-		}
+// swap replaces the configuration and pool with those of next, returning
+// the previous pool. The caller must hold the lock. Every configuration
+// field has to be copied here.
+func (c *SQLConnectionProducer) swap(next *SQLConnectionProducer) *sql.DB {
+	c.ConnectionURL = next.ConnectionURL
+	c.MaxOpenConnections = next.MaxOpenConnections
+	c.MaxIdleConnections = next.MaxIdleConnections
+	c.MaxConnectionLifetimeRaw = next.MaxConnectionLifetimeRaw
+	c.Username = next.Username
+	c.Password = next.Password
+	c.TemplateVars = next.TemplateVars
+	c.Dialect = next.Dialect
+	c.ValidationStatements = next.ValidationStatements
+	c.StrictPrivilegeCheck = next.StrictPrivilegeCheck
+	c.AuditLogins = next.AuditLogins
+	c.AuditOptions = next.AuditOptions
+	c.OwnedObjectsPolicy = next.OwnedObjectsPolicy
+	c.TargetServers = next.TargetServers
+	c.PasswordExpiryWarningDays = next.PasswordExpiryWarningDays
+	c.RawConfig = next.RawConfig
+	c.maxConnectionLifetime = next.maxConnectionLifetime
+	c.Initialized = next.Initialized
 
-		if err := c.db.PingContext(ctx); err != nil {
-			return nil, errwrap.Wrapf("error verifying connection: {{err}}", err)
-		}
-	}
+	c.dbLock.Lock()
+	defer c.dbLock.Unlock()
 
-	return c.RawConfig, nil
+	old := c.db
+	c.db = next.db
+	return old
 }
 
 func (c *SQLConnectionProducer) Connection(ctx context.Context) (interface{}, error) {
@@ -98,6 +219,9 @@ func (c *SQLConnectionProducer) Connection(ctx context.Context) (interface{}, er
 		return nil, ErrNotInitialized
 	}
 
+	c.dbLock.Lock()
+	defer c.dbLock.Unlock()
+
 	// If we already have a DB, test it and return
 	if c.db != nil {
 		if err := c.db.PingContext(ctx); err == nil {
@@ -129,9 +253,18 @@ func (c *SQLConnectionProducer) Connection(ctx context.Context) (interface{}, er
 }
 
 func (c *SQLConnectionProducer) SecretValues() map[string]interface{} {
-	return map[string]interface{}{
+	c.RLock()
+	defer c.RUnlock()
+
+	secrets := map[string]interface{}{
 		c.Password: "[password]",
 	}
+	for _, t := range c.TargetServers {
+		if t.Password != "" {
+			secrets[t.Password] = "[password]"
+		}
+	}
+	return secrets
 }
 
 // Close attempts to close the connection
@@ -140,6 +273,9 @@ func (c *SQLConnectionProducer) Close() error {
 	c.Lock()
 	defer c.Unlock()
 
+	c.dbLock.Lock()
+	defer c.dbLock.Unlock()
+
 	if c.db != nil {
 		c.db.Close()
 	}
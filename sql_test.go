@@ -0,0 +1,297 @@
+package sybase
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+const fakeDriverName = "sybase_fake"
+
+var (
+	fakeDriverRegister sync.Once
+	testFakeDriver     = &fakeDriver{open: map[string]int{}}
+)
+
+// fakeDriver counts the connections open to each connection string, and
+// answers the queries Init runs as an ASE 16.0 server where the login has
+// no roles would, and every other query with a single row holding "master".
+type fakeDriver struct {
+	lock sync.Mutex
+	open map[string]int
+}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.open[dsn]++
+	return &fakeConn{driver: d, dsn: dsn}, nil
+}
+
+func (d *fakeDriver) openConnections(dsn string) int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.open[dsn]
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+	dsn    string
+}
+
+// Statements executed on connections to a server whose name contains "fail"
+// fail.
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{fail: strings.Contains(c.dsn, "fail"), dsn: c.dsn, query: query}, nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c *fakeConn) Close() error {
+	c.driver.lock.Lock()
+	defer c.driver.lock.Unlock()
+	c.driver.open[c.dsn]--
+	return nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	fail  bool
+	dsn   string
+	query string
+}
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.fail {
+		return nil, errors.New("Msg 102, Level 15, State 1\nServer 'FAIL', Line 1\nIncorrect syntax")
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	// Procedure calls fail like statements do
+	if s.fail && strings.Contains(s.query, "EXEC @vault_status") {
+		return nil, errors.New("Msg 17001, Level 16, State 1\nServer 'FAIL', Line 4\nprocedure returned status 1")
+	}
+	switch {
+	case strings.Contains(s.query, "EXEC @vault_status"):
+		return s.procedureRows(), nil
+	case strings.Contains(s.query, "@@tranchained"):
+		return &fakeRows{rows: [][]driver.Value{{"master", int64(0), int64(0), int64(1), int64(32768)}}}, nil
+	case strings.Contains(s.query, "@@version_number"):
+		return &fakeRows{rows: [][]driver.Value{{int64(16000)}}}, nil
+	case strings.Contains(s.query, "@@version"):
+		return &fakeRows{rows: [][]driver.Value{{"Adaptive Server Enterprise/16.0 SP03"}}}, nil
+	case strings.Contains(s.query, "sysconfigures"):
+		return &fakeRows{columns: 2}, nil
+	case strings.Contains(s.query, "show_role()"):
+		return &fakeRows{rows: [][]driver.Value{{"vaultadmin", ""}}}, nil
+	case strings.Contains(s.query, "proc_role("):
+		return &fakeRows{rows: [][]driver.Value{{int64(0)}}}, nil
+	case strings.Contains(s.query, "sysattributes WHERE class = 6 AND object_type = 'EC'"):
+		// No execution classes beyond the predefined ones
+		return &fakeRows{rows: [][]driver.Value{{int64(0)}}}, nil
+	case strings.Contains(s.query, "syslogins WHERE name ="):
+		// Servers whose name contains "nologin" have no logins
+		if strings.Contains(s.dsn, "nologin") {
+			return &fakeRows{rows: [][]driver.Value{{int64(0)}}}, nil
+		}
+		return &fakeRows{rows: [][]driver.Value{{int64(1)}}}, nil
+	}
+	return &fakeRows{rows: [][]driver.Value{{"master"}}}, nil
+}
+
+// procedureRows answers a procedure call with its output parameters, set to
+// 42. On servers whose name contains "results" the procedure first selects a
+// result set of its own, and on those whose name contains "first-only" the
+// driver returns only that.
+func (s fakeStmt) procedureRows() *fakeRows {
+	if !strings.Contains(s.query, "vault_outputs") {
+		return &fakeRows{}
+	}
+	outputs := &fakeRows{names: []string{procedureOutputsColumn, "@login_id"}, rows: [][]driver.Value{{procedureOutputsColumn, int64(42)}}}
+	own := &fakeRows{names: []string{"login"}, rows: [][]driver.Value{{"v_root_test"}}}
+	switch {
+	case strings.Contains(s.dsn, "first-only"):
+		return own
+	case strings.Contains(s.dsn, "results"):
+		own.next = outputs
+		return own
+	}
+	return outputs
+}
+
+type fakeRows struct {
+	names   []string
+	rows    [][]driver.Value
+	columns int
+
+	// next is the following result set.
+	next *fakeRows
+}
+
+func (r *fakeRows) HasNextResultSet() bool { return r.next != nil }
+
+func (r *fakeRows) NextResultSet() error {
+	if r.next == nil {
+		return io.EOF
+	}
+	*r = *r.next
+	return nil
+}
+
+func (r *fakeRows) Columns() []string {
+	if r.names != nil {
+		return r.names
+	}
+	n := r.columns
+	if len(r.rows) > 0 {
+		n = len(r.rows[0])
+	}
+	return make([]string, n)
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func newFakeSYBASE() *SYBASE {
+	fakeDriverRegister.Do(func() {
+		sql.Register(fakeDriverName, testFakeDriver)
+	})
+
+	db := new()
+	db.SQLConnectionProducer.Type = fakeDriverName
+	return db
+}
+
+func TestSQLConnectionProducer_InitKeepsConfigOnError(t *testing.T) {
+	db := newFakeSYBASE()
+	if _, err := db.SQLConnectionProducer.Init(context.Background(), map[string]interface{}{"connection_url": "Server=keep"}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Init(context.Background(), map[string]interface{}{"connection_url": "Server=bad", "dialect": "invalid"}, false); err == nil {
+		t.Fatal("expected an error for an invalid dialect")
+	}
+	if db.ConnectionURL != "Server=keep" {
+		t.Fatalf("expected the previous configuration to be kept, got %q", db.ConnectionURL)
+	}
+	if testFakeDriver.openConnections("Server=keep") == 0 {
+		t.Fatal("expected the previous pool to be kept open")
+	}
+	db.Close()
+}
+
+func TestSYBASE_InitKeepsConfigOnFailedPrivilegeCheck(t *testing.T) {
+	db := newFakeSYBASE()
+	ctx := context.Background()
+	if _, err := db.Init(ctx, map[string]interface{}{"connection_url": "Server=privileged"}, false); err != nil {
+		t.Fatal(err)
+	}
+	caps := &Capabilities{VersionNumber: 15500, Dialect: dialectLegacy}
+	db.setCapabilities(caps)
+
+	// The fake login has neither sso_role nor sa_role
+	_, err := db.Init(ctx, map[string]interface{}{
+		"connection_url":         "Server=unprivileged",
+		"strict_privilege_check": true,
+	}, true)
+	if err == nil || !strings.Contains(err.Error(), "missing privileges") {
+		t.Fatalf("expected a privilege error, got %v", err)
+	}
+	if db.ConnectionURL != "Server=privileged" || db.StrictPrivilegeCheck {
+		t.Fatalf("expected the previous configuration to be kept, got %q", db.ConnectionURL)
+	}
+	if got, _ := db.Capabilities(ctx); got != caps {
+		t.Fatalf("expected the previous capabilities to be kept, got %#v", got)
+	}
+	if testFakeDriver.openConnections("Server=unprivileged") != 0 {
+		t.Fatal("expected the rejected pool to be closed")
+	}
+	db.Close()
+}
+
+func TestSQLConnectionProducer_ConcurrentInitAndCreateUser(t *testing.T) {
+	db := newFakeSYBASE()
+	ctx := context.Background()
+	conf := func(server string) map[string]interface{} {
+		return map[string]interface{}{"connection_url": "Server=" + server}
+	}
+
+	if _, err := db.Init(ctx, conf("concurrent-0"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	statements := dbplugin.Statements{
+		Creation: []string{"CREATE LOGIN {{name}} WITH PASSWORD {{password}}"},
+	}
+	usernameConfig := dbplugin.UsernameConfig{DisplayName: "test", RoleName: "test"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, _, err := db.CreateUser(ctx, statements, usernameConfig, time.Now().Add(time.Hour)); err != nil {
+				errs <- err
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			if _, err := db.Init(ctx, conf([]string{"concurrent-0", "concurrent-1"}[i%2]), false); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Init(ctx, conf("concurrent-final"), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.CreateUser(ctx, statements, usernameConfig, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every pool but the current one has been drained and closed
+	for _, server := range []string{"concurrent-0", "concurrent-1"} {
+		if n := testFakeDriver.openConnections("Server=" + server); n != 0 {
+			t.Fatalf("expected the pool for %s to be closed, %d connections are open", server, n)
+		}
+	}
+	if testFakeDriver.openConnections("Server=concurrent-final") == 0 {
+		t.Fatal("expected the current pool to be open")
+	}
+
+	db.Close()
+	if n := testFakeDriver.openConnections("Server=concurrent-final"); n != 0 {
+		t.Fatalf("expected Close to close the pool, %d connections are open", n)
+	}
+}
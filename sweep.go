@@ -0,0 +1,143 @@
+package sybase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Actions the sweeper can take on an orphaned login.
+const (
+	SweepActionReport = "report"
+	SweepActionLock   = "lock"
+	SweepActionDrop   = "drop"
+)
+
+// SweepOptions configures a sweep for orphaned logins.
+type SweepOptions struct {
+	// MaxTTL is the age after which a managed login is considered orphaned.
+	// It should be at least the max_ttl of every role on the mount.
+	MaxTTL time.Duration
+
+	// Action is one of SweepActionReport, SweepActionLock or SweepActionDrop.
+	Action string
+
+	// DryRun reports what Action would do without doing it.
+	DryRun bool
+}
+
+// SweptLogin is an orphaned login found by a sweep.
+type SweptLogin struct {
+	Name          string    `json:"name"`
+	Created       time.Time `json:"created"`
+	CreatedSource string    `json:"created_source"`
+	Age           string    `json:"age"`
+	Locked        bool      `json:"locked"`
+	Action        string    `json:"action"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// SweepReport is the outcome of a sweep.
+type SweepReport struct {
+	DryRun bool         `json:"dry_run"`
+	Action string       `json:"action"`
+	MaxTTL string       `json:"max_ttl"`
+	Logins []SweptLogin `json:"logins"`
+}
+
+// SweepOrphanedLogins finds managed logins older than opts.MaxTTL and
+// reports, locks or drops them. Vault revokes every login it issued by the
+// time its lease reaches max_ttl, so an older login has lost its lease.
+//
+// A login's age comes from syslogins. Generated usernames end in their
+// creation time, but the generator truncates them to 30 characters, which
+// always cuts the time off.
+func (m *SYBASE) SweepOrphanedLogins(ctx context.Context, opts SweepOptions) (*SweepReport, error) {
+	switch opts.Action {
+	case SweepActionReport, SweepActionLock, SweepActionDrop:
+	default:
+		return nil, fmt.Errorf("invalid sweep action %q", opts.Action)
+	}
+	if opts.MaxTTL <= 0 {
+		return nil, fmt.Errorf("a positive max TTL is required")
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+
+	logins, err := m.ListManagedLogins(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SweepReport{
+		DryRun: opts.DryRun,
+		Action: opts.Action,
+		MaxTTL: opts.MaxTTL.String(),
+		Logins: selectOrphans(logins, opts.MaxTTL, time.Now()),
+	}
+
+	for i := range report.Logins {
+		login := &report.Logins[i]
+		login.Action = opts.Action
+		if opts.DryRun || opts.Action == SweepActionReport {
+			continue
+		}
+
+		switch opts.Action {
+		case SweepActionLock:
+			if login.Locked {
+				continue
+			}
+			err = m.lockLogin(ctx, login.Name)
+		case SweepActionDrop:
+			err = m.revokeUserDefault(ctx, login.Name, "")
+		}
+		if err != nil {
+			login.Error = err.Error()
+			continue
+		}
+		log.Printf("Sweeper: %s orphaned login '%s' created %s", opts.Action, login.Name, login.Created)
+	}
+
+	return report, nil
+}
+
+// selectOrphans returns the logins created more than maxTTL before now.
+func selectOrphans(logins []ManagedLogin, maxTTL time.Duration, now time.Time) []SweptLogin {
+	var orphans []SweptLogin
+	for _, login := range logins {
+		age := now.Sub(login.Created)
+		if age <= maxTTL {
+			continue
+		}
+
+		orphans = append(orphans, SweptLogin{
+			Name:          login.Name,
+			Created:       login.Created,
+			CreatedSource: login.CreatedSource,
+			Age:           age.Truncate(time.Second).String(),
+			Locked:        login.Locked,
+		})
+	}
+	return orphans
+}
+
+// lockLogin locks a login so that it can no longer connect.
+func (m *SYBASE) lockLogin(ctx context.Context, username string) error {
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	sess, err := newSession(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer sess.close(ctx)
+
+	return sess.execQuery(ctx, fmt.Sprintf(lockLoginSQL, escapeBare(username)))
+}
+
+const lockLoginSQL = `master.dbo.sp_locklogin %s, "lock"`
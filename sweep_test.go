@@ -0,0 +1,41 @@
+package sybase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+// generateUsername returns a username as the plugin generates it.
+func generateUsername(t *testing.T, displayName, roleName string) string {
+	username, err := new().GenerateUsername(dbplugin.UsernameConfig{DisplayName: displayName, RoleName: roleName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(username) != 30 {
+		t.Fatalf("expected a 30 character username, got %q", username)
+	}
+	return username
+}
+
+func TestSelectOrphans(t *testing.T) {
+	now := time.Now()
+	young, old, rotated := generateUsername(t, "token", "app"), generateUsername(t, "token", "app"), generateUsername(t, "root", "reporting")
+	logins := []ManagedLogin{
+		{Name: young, Created: now.Add(-time.Hour), CreatedSource: createdSourceCrdate},
+		{Name: old, Created: now.Add(-48 * time.Hour), CreatedSource: createdSourceCrdate, Locked: true},
+		{Name: rotated, Created: now.Add(-72 * time.Hour), CreatedSource: createdSourcePwdate},
+	}
+
+	orphans := selectOrphans(logins, 24*time.Hour, now)
+	if len(orphans) != 2 {
+		t.Fatalf("expected 2 orphans, got %#v", orphans)
+	}
+	if orphans[0].Name != old || orphans[0].CreatedSource != createdSourceCrdate || !orphans[0].Locked {
+		t.Fatalf("unexpected orphan: %#v", orphans[0])
+	}
+	if orphans[1].CreatedSource != createdSourcePwdate || !orphans[1].Created.Equal(now.Add(-72*time.Hour)) {
+		t.Fatalf("unexpected orphan: %#v", orphans[1])
+	}
+}
@@ -5,15 +5,16 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"strings"
+	"sync"
 	"time"
-	"log"
 
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
 	"github.com/hashicorp/vault/helper/dbtxn"
-	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/plugins"
 	"github.com/hashicorp/vault/plugins/helper/database/credsutil"
 	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
@@ -28,6 +29,16 @@ var _ dbplugin.Database = &SYBASE{}
 type SYBASE struct {
 	*SQLConnectionProducer
 	credsutil.CredentialsProducer
+
+	capabilities     *Capabilities
+	capabilitiesLock sync.Mutex
+
+	// expiryCheckedAt is when the root password's expiry was last checked.
+	expiryCheckedAt time.Time
+	expiryLock      sync.Mutex
+
+	// targets are the servers in target_servers, guarded by the lock.
+	targets []fanoutTarget
 }
 
 func New() (interface{}, error) {
@@ -38,6 +49,12 @@ func New() (interface{}, error) {
 	return dbType, nil
 }
 
+// NewSYBASE returns a SYBASE instance without the error sanitizing middleware,
+// for use outside of Vault's plugin server such as the operator subcommands.
+func NewSYBASE() *SYBASE {
+	return new()
+}
+
 func new() *SYBASE {
 	connProducer := &SQLConnectionProducer{}
 	connProducer.Type = sybaseTypeName
@@ -66,6 +83,112 @@ func Run(apiTLSConfig *api.TLSConfig) error {
 	return nil
 }
 
+// Init configures the connection. When verifyConnection is set, the server's
+// capabilities are detected, the login's privileges are checked, and
+// statements supplied in validate_statements are validated against the
+// server, any failure failing the configuration. All of this happens on a new
+// instance, which only replaces the current configuration, pool, target
+// servers and capabilities once it passes, so a failed Init leaves the plugin
+// as it was.
+func (m *SYBASE) Init(ctx context.Context, conf map[string]interface{}, verifyConnection bool) (map[string]interface{}, error) {
+	next := new()
+	next.SQLConnectionProducer.Type = m.SQLConnectionProducer.Type
+
+	saveConf, err := next.SQLConnectionProducer.Init(ctx, conf, verifyConnection)
+	if err != nil {
+		return nil, err
+	}
+
+	next.targets, err = m.initTargets(ctx, conf, verifyConnection)
+	if err != nil {
+		next.SQLConnectionProducer.Close()
+		return nil, err
+	}
+
+	if verifyConnection {
+		if err := next.verify(ctx); err != nil {
+			next.Close()
+			return nil, err
+		}
+	}
+
+	m.Lock()
+	oldDB := m.SQLConnectionProducer.swap(next.SQLConnectionProducer)
+	oldTargets := m.targets
+	m.targets = next.targets
+	m.setCapabilities(next.capabilities)
+	m.Unlock()
+
+	// The swap waited for operations using the old pool to finish
+	if oldDB != nil {
+		oldDB.Close()
+	}
+	closeTargets(oldTargets)
+
+	if verifyConnection {
+		m.RLock()
+		m.checkRootPasswordExpiry(ctx, true)
+		m.RUnlock()
+	}
+
+	return saveConf, nil
+}
+
+// verify runs the checks of a verified Init against a configuration that is
+// not in use yet.
+func (m *SYBASE) verify(ctx context.Context) error {
+	caps, err := m.Capabilities(ctx)
+	if err != nil {
+		return errwrap.Wrapf("error detecting server capabilities: {{err}}", err)
+	}
+
+	if err := checkOwnedObjectsPolicy(m.OwnedObjectsPolicy, caps); err != nil {
+		return err
+	}
+
+	if err := m.checkPrivilegesAtInit(ctx); err != nil {
+		return err
+	}
+
+	if m.ValidationStatements.empty() {
+		return nil
+	}
+
+	statements := dbplugin.Statements{
+		Creation:   m.ValidationStatements.Creation,
+		Renewal:    m.ValidationStatements.Renewal,
+		Revocation: m.ValidationStatements.Revocation,
+	}
+	report, err := m.ValidateStatements(ctx, statements, m.ValidationStatements.Rotation)
+	if err != nil {
+		return errwrap.Wrapf("error validating statements: {{err}}", err)
+	}
+	return report.Err()
+}
+
+// Initialize is the deprecated form of Init.
+func (m *SYBASE) Initialize(ctx context.Context, conf map[string]interface{}, verifyConnection bool) error {
+	_, err := m.Init(ctx, conf, verifyConnection)
+	return err
+}
+
+// Close closes the connections to the primary and every target server.
+func (m *SYBASE) Close() error {
+	m.Lock()
+	targets := m.targets
+	m.targets = nil
+	m.Unlock()
+
+	var result *multierror.Error
+	if err := closeTargets(targets); err != nil {
+		result = multierror.Append(result, err)
+	}
+	if err := m.SQLConnectionProducer.Close(); err != nil {
+		result = multierror.Append(result, err)
+	}
+	return result.ErrorOrNil()
+}
+
 // Type returns the TypeName for this backend
 func (m *SYBASE) Type() (string, error) {
 	return sybaseTypeName, nil
@@ -83,18 +206,14 @@ func (m *SYBASE) getConnection(ctx context.Context) (*sql.DB, error) {
 // CreateUser generates the username/password on the underlying SYBASE secret backend as instructed by
 // the CreationStatement provided.
 func (m *SYBASE) CreateUser(ctx context.Context, statements dbplugin.Statements, usernameConfig dbplugin.UsernameConfig, expiration time.Time) (username string, password string, err error) {
-  log.Println("Calling CreateUser()")
+	log.Println("Calling CreateUser()")
 	// Grab the lock
 	m.Lock()
 	defer m.Unlock()
 
-	statements = dbutil.StatementCompatibilityHelper(statements)
+	m.checkRootPasswordExpiry(ctx, false)
 
-	// Get the connection
-	db, err := m.getConnection(ctx)
-	if err != nil {
-		return "", "", err
-	}
+	statements = dbutil.StatementCompatibilityHelper(statements)
 
 	if len(statements.Creation) == 0 {
 		return "", "", dbutil.ErrEmptyCreationStatement
@@ -111,53 +230,196 @@ func (m *SYBASE) CreateUser(ctx context.Context, statements dbplugin.Statements,
 	}
 	password = strings.Replace(password, "-", "_", -1)
 
+	if err := m.createUser(ctx, statements, username, password, usernameConfig, expiration); err != nil {
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// createLogin runs the creation statements, or calls the create procedure,
+// on this server for a login whose username and password have already been
+// chosen. The caller must hold the lock.
+func (m *SYBASE) createLogin(ctx context.Context, statements dbplugin.Statements, username, password string, usernameConfig dbplugin.UsernameConfig, expiration time.Time) error {
+	role, creation, err := parseRoleDocument(statements)
+	if err != nil {
+		return err
+	}
+	if !role.storedProcedures() && len(creation) == 0 {
+		return dbutil.ErrEmptyCreationStatement
+	}
+
+	// Fail before the login exists rather than revoke it after
+	if err := m.checkBindings(ctx, role); err != nil {
+		return err
+	}
+
 	expirationStr, err := m.GenerateExpiration(expiration)
 	if err != nil {
-		return "", "", err
+		return err
 	}
 
-	// Execute each query
-	for _, stmt := range statements.Creation {
-		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
-			query = strings.TrimSpace(query)
-			if len(query) == 0 {
-				continue
-			}
+	vars := templateVarsFor(m.TemplateVars, map[string]interface{}{
+		"name":         username,
+		"password":     password,
+		"role_name":    usernameConfig.RoleName,
+		"display_name": usernameConfig.DisplayName,
+	}, expirationVars(expiration, expirationStr))
 
-			m := map[string]string{
-				"name":       username,
-				"password":   password,
-				"expiration": expirationStr,
-			}
+	if role.storedProcedures() {
+		err = m.execProcedure(ctx, role.Procedures.Create, vars)
+	} else {
+		err = m.execCreation(ctx, creation, vars, role.ExecuteAs)
+	}
+	if err != nil {
+		return err
+	}
 
-      if err := dbtxn.ExecuteDBQuery(ctx, db, m, query); err != nil {
-				return "", "", err
-			}
+	if err := m.applyLoginOptions(ctx, role, username, usernameConfig); err != nil {
+		// The login must not be handed out without its options
+		if revokeErr := m.revokeLogin(ctx, statements, username); revokeErr != nil {
+			log.Printf("Could not revoke login '%s' after failing to apply its options: %s", username, revokeErr)
 		}
+		return err
 	}
+	return nil
+}
 
-	return username, password, nil
+// execCreation runs the creation statements, as the executeAs login if one
+// is given.
+func (m *SYBASE) execCreation(ctx context.Context, creation []string, vars map[string]interface{}, executeAs string) error {
+	// Get the connection
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Pin a single connection so that USE statements carry over
+	sess, err := m.newRoleSession(ctx, db, executeAs)
+	if err != nil {
+		return err
+	}
+	defer sess.close(ctx)
+
+	// Execute each query
+	return sess.execCreationStatements(ctx, creation, vars)
 }
 
-// RenewUser is not supported on SYBASE, so this is a no-op.
+// newRoleSession starts a session that executes as the executeAs login, or
+// as the configured login if executeAs is empty.
+func (m *SYBASE) newRoleSession(ctx context.Context, db *sql.DB, executeAs string) (*session, error) {
+	sess, err := newSession(ctx, db)
+	if err != nil || executeAs == "" {
+		return sess, err
+	}
+
+	if err := sess.executeAs(ctx, executeAs); err != nil {
+		sess.close(ctx)
+		return nil, err
+	}
+	return sess, nil
+}
+
+// RenewUser runs the renewal statements or calls the renew procedure, if
+// any were provided, on every server. Sybase has no notion of a login
+// expiring at a point in time, so without either this is a no-op.
 func (m *SYBASE) RenewUser(ctx context.Context, statements dbplugin.Statements, username string, expiration time.Time) error {
-	// NOOP
-	// But note that we could do this for Sybase if we convert
-	// format of ttl back to number of days using:
-	// alter login {{username}} modify password expiration {{expiration}}
-	// probably first using time.Parse() followed by Until()
-	// followed by Hours() / 24.
-	return nil
+	m.RLock()
+	defer m.RUnlock()
+
+	m.checkRootPasswordExpiry(ctx, false)
+
+	return m.renewUser(ctx, statements, username, expiration)
+}
+
+// renewLogin renews the login on this server. The caller must hold the lock.
+func (m *SYBASE) renewLogin(ctx context.Context, statements dbplugin.Statements, username string, expiration time.Time) error {
+	statements = dbutil.StatementCompatibilityHelper(statements)
+
+	role, _, err := parseRoleDocument(statements)
+	if err != nil {
+		return err
+	}
+
+	if len(statements.Renewal) == 0 && role.Procedures.Renew == nil {
+		return nil
+	}
+
+	expirationStr, err := m.GenerateExpiration(expiration)
+	if err != nil {
+		return err
+	}
+
+	vars := templateVarsFor(m.TemplateVars, map[string]interface{}{
+		"name": username,
+	}, expirationVars(expiration, expirationStr))
+
+	if role.storedProcedures() {
+		return m.execProcedure(ctx, role.Procedures.Renew, vars)
+	}
+
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	sess, err := newSession(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer sess.close(ctx)
+
+	return sess.execStatements(ctx, statements.Renewal, vars)
 }
 
-// RevokeUser attempts to drop the specified user. It will first attempt to disable login,
+// RevokeUser attempts to drop the specified user on every server. It will first attempt to disable login,
 // then drop the login and user from the
 // database instance.
 func (m *SYBASE) RevokeUser(ctx context.Context, statements dbplugin.Statements, username string) error {
+	m.RLock()
+	defer m.RUnlock()
+
+	m.checkRootPasswordExpiry(ctx, false)
+
+	return m.revokeUser(ctx, statements, username)
+}
+
+// revokeLogin revokes the login on this server. The caller must hold the
+// lock.
+func (m *SYBASE) revokeLogin(ctx context.Context, statements dbplugin.Statements, username string) error {
 	statements = dbutil.StatementCompatibilityHelper(statements)
 
+	role, _, err := parseRoleDocument(statements)
+	if err != nil {
+		return err
+	}
+
+	// The default revocation removes the options itself
+	if (role.loginOptions() || m.AuditLogins) && (role.storedProcedures() || len(statements.Revocation) > 0) {
+		db, err := m.getConnection(ctx)
+		if err != nil {
+			return err
+		}
+
+		sess, err := newSession(ctx, db)
+		if err != nil {
+			return err
+		}
+		err = m.removeLoginOptions(ctx, sess, username)
+		sess.close(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if role.storedProcedures() {
+		return m.execProcedure(ctx, role.Procedures.Revoke, templateVarsFor(m.TemplateVars, map[string]interface{}{
+			"name": username,
+		}))
+	}
+
 	if len(statements.Revocation) == 0 {
-		return m.revokeUserDefault(ctx, username)
+		return m.revokeUserDefault(ctx, username, role.ExecuteAs)
 	}
 
 	// Get connection
@@ -166,26 +428,33 @@ func (m *SYBASE) RevokeUser(ctx context.Context, statements dbplugin.Statements,
 		return err
 	}
 
+	sess, err := m.newRoleSession(ctx, db, role.ExecuteAs)
+	if err != nil {
+		return err
+	}
+	defer sess.close(ctx)
+
 	// Start a transaction
-	tx, err := db.BeginTx(ctx, nil)
+	tx, err := sess.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	vars := templateVarsFor(m.TemplateVars, map[string]interface{}{
+		"name": username,
+	})
+
 	// Execute each query
 	for _, stmt := range statements.Revocation {
-		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
-			query = strings.TrimSpace(query)
-			if len(query) == 0 {
-				continue
-			}
-
-			m := map[string]string{
-				"name": username,
-			}
-			if err := dbtxn.ExecuteTxQuery(ctx, tx, m, query); err != nil {
-				return err
+		rendered, err := renderStatement(stmt, vars)
+		if err != nil {
+			return err
+		}
+		for _, query := range splitStatements(rendered) {
+			sess.trackOptions(query)
+			if err := dbtxn.ExecuteTxQuery(ctx, tx, nil, query); err != nil {
+				return newServerError(err)
 			}
 		}
 	}
@@ -198,70 +467,98 @@ func (m *SYBASE) RevokeUser(ctx context.Context, statements dbplugin.Statements,
 	return nil
 }
 
-func (m *SYBASE) revokeUserDefault(ctx context.Context, username string) error {
+// revokeUserDefault locks and drops the login, as the executeAs login if one
+// is given.
+func (m *SYBASE) revokeUserDefault(ctx context.Context, username, executeAs string) error {
 	// Get connection
 	db, err := m.getConnection(ctx)
 	if err != nil {
 		return err
 	}
 
+	caps, err := m.Capabilities(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Fail before the login is touched if the objects it owns cannot be
+	// handled on this server
+	if err := checkOwnedObjectsPolicy(m.OwnedObjectsPolicy, caps); err != nil {
+		return err
+	}
+
+	sess, err := m.newRoleSession(ctx, db, executeAs)
+	if err != nil {
+		return err
+	}
+	defer sess.close(ctx)
+
 	// First, disable server login
-	lockLoginStmt, err := db.PrepareContext(ctx, fmt.Sprintf("master.dbo.sp_locklogin %s , \"lock\"", username))
+	lockLoginStmt, err := sess.conn.PrepareContext(ctx, fmt.Sprintf(lockLoginSQL, username))
 	if err != nil {
-		return errwrap.Wrapf("Could not prepare context for locking login: {{err}}", err)
+		return errwrap.Wrapf("Could not prepare context for locking login: {{err}}", newServerError(err))
 	}
 	defer lockLoginStmt.Close()
 	if _, err := lockLoginStmt.ExecContext(ctx); err != nil {
-		return errwrap.Wrapf("Could not execute context for locking login: {{err}}", err)
+		return errwrap.Wrapf("Could not execute context for locking login: {{err}}", newServerError(err))
 	}
 
-	// Find the default database for the login
-	// There should only be one
-	var defaultDatabase string
-	defaultDatabaseStmt, err := db.PrepareContext(ctx, fmt.Sprintf("SELECT dbname FROM master.dbo.syslogins WHERE name = '%s'", username))
+	// Drop the user from every database it is in, after dealing with the
+	// objects it owns there according to owned_objects_policy
+	databases, err := sess.userDatabases(ctx, username)
 	if err != nil {
-		return errwrap.Wrapf("Could not prepare context for selecting dbname from syslogins: {{err}}", err)
+		return err
 	}
-	defer defaultDatabaseStmt.Close()
+	for _, database := range databases {
+		// An alias owns nothing, the user it maps to does
+		if database.Alias {
+			if err := m.dropAlias(ctx, sess, database.Name, username); err != nil {
+				return err
+			}
+			continue
+		}
 
-	err = defaultDatabaseStmt.QueryRowContext(ctx).Scan(&defaultDatabase)
-	switch {
-	  case err == sql.ErrNoRows:
-		  log.Println("No rows for defaultDatabase")
-			return errwrap.Wrapf("No rows for defaultDatabase: {{err}}", err)
-			//defaultDatabase = "vault"
-	  case err != nil:
-			log.Println("Some other error retrieving defaultDatabase")
-		  return errwrap.Wrapf("Could not query context for selecting dbname from syslogins: {{err}}", err)
-		default:
-			log.Printf("Found defaultDatabase: '%s'", defaultDatabase)
+		actions, err := sess.handleOwnedObjects(ctx, m.OwnedObjectsPolicy, database)
+		for _, action := range actions {
+			log.Printf("Revoking '%s': %s", username, action)
+		}
+		if err != nil {
+			return err
+		}
+
+		// The user may have a name other than the login's
+		if err := m.dropUser(ctx, sess, database.Name, database.User); err != nil {
+			return err
+		}
 	}
 
-  dropUser := fmt.Sprintf(dropUserSQL, defaultDatabase, username, defaultDatabase, username)
-	dropUserStmt, err := db.PrepareContext(ctx, dropUser)
-	log.Printf("Invoking statement, '%s' to drop user from database '%s'", strings.Replace(dropUser, "\n", " ", -1), defaultDatabase)
+	// Limits and bindings outlive their login, and may be left from a role
+	// since deleted. Removing them takes the configured login's own roles,
+	// not those of the login the role session acts as.
+	optionsSess, err := newSession(ctx, db)
 	if err != nil {
-		return errwrap.Wrapf("Could not prepare context for dropping user: {{err}}", err)
+		return err
 	}
-
-	defer dropUserStmt.Close()
-	if _, err = dropUserStmt.ExecContext(ctx); err != nil {
-		return errwrap.Wrapf("could not drop user from database: {{err}}", err)
-	} else {
-		log.Printf("Dropped user '%s' from database '%s'", username, defaultDatabase)
+	err = m.removeLoginOptions(ctx, optionsSess, username)
+	optionsSess.close(ctx)
+	if err != nil {
+		return err
 	}
 
 	// Drop this login
-	dropLogin := fmt.Sprintf(dropLoginSQL, username, username)
-	dropLoginStmt, err := db.PrepareContext(ctx, dropLogin)
+	dropLogin := fmt.Sprintf(dropLoginLegacySQL, username, username)
+	if caps.modern() {
+		dropLogin = fmt.Sprintf(dropLoginSQL, username, username)
+	}
+	dropLoginStmt, err := sess.conn.PrepareContext(ctx, dropLogin)
 	log.Printf("Invoking statement, '%s' to drop login '%s'", strings.Replace(dropLogin, "\n", " ", -1), username)
 	if err != nil {
-		return errwrap.Wrapf("Could not prepare context for dropping login: {{err}}", err)
+		return errwrap.Wrapf("Could not prepare context for dropping login: {{err}}", newServerError(err))
 	}
 
 	defer dropLoginStmt.Close()
 	if _, err = dropLoginStmt.ExecContext(ctx); err != nil {
-		return errwrap.Wrapf("could not drop login from database: {{err}}", err)
+		return errwrap.Wrapf("could not drop login from database: {{err}}", newServerError(err))
 	} else {
 		log.Printf("Dropped login '%s'", username)
 	}
@@ -269,6 +566,32 @@ func (m *SYBASE) revokeUserDefault(ctx context.Context, username string) error {
 	return nil
 }
 
+func (m *SYBASE) dropUser(ctx context.Context, sess *session, database, username string) error {
+	dropUser := fmt.Sprintf(dropUserSQL, database, username, database, username)
+	dropUserStmt, err := sess.conn.PrepareContext(ctx, dropUser)
+	log.Printf("Invoking statement, '%s' to drop user from database '%s'", strings.Replace(dropUser, "\n", " ", -1), database)
+	if err != nil {
+		return errwrap.Wrapf("Could not prepare context for dropping user: {{err}}", newServerError(err))
+	}
+
+	defer dropUserStmt.Close()
+	if _, err = dropUserStmt.ExecContext(ctx); err != nil {
+		return errwrap.Wrapf("could not drop user from database: {{err}}", newServerError(err))
+	}
+	log.Printf("Dropped user '%s' from database '%s'", username, database)
+	return nil
+}
+
+func (m *SYBASE) dropAlias(ctx context.Context, sess *session, database, username string) error {
+	dropAlias := fmt.Sprintf(dropAliasSQL, quoteIdent(database), quoteLiteral(username))
+	log.Printf("Invoking statement, '%s' to drop alias from database '%s'", dropAlias, database)
+	if err := sess.execQuery(ctx, dropAlias); err != nil {
+		return errwrap.Wrapf("could not drop alias from database: {{err}}", err)
+	}
+	log.Printf("Dropped alias '%s' from database '%s'", username, database)
+	return nil
+}
+
 func (m *SYBASE) RotateRootCredentials(ctx context.Context, statements []string) (map[string]interface{}, error) {
 	m.Lock()
 	defer m.Unlock()
@@ -276,18 +599,10 @@ func (m *SYBASE) RotateRootCredentials(ctx context.Context, statements []string)
 	if len(m.Username) == 0 || len(m.Password) == 0 {
 		return nil, errors.New("username and password are required to rotate")
 	}
-
-	rotateStatements := statements
-	if len(rotateStatements) == 0 {
-		rotateStatements = []string{rotateRootCredentialsSQL}
-	}
-
-	db, err := m.getConnection(ctx)
-	if err != nil {
+	if err := m.checkNoEmbeddedPassword(); err != nil {
 		return nil, err
 	}
 
-	old_password := m.Password
 	log.Println("Generating new password")
 	password, err := m.GeneratePassword()
 	if err != nil {
@@ -295,26 +610,7 @@ func (m *SYBASE) RotateRootCredentials(ctx context.Context, statements []string)
 	}
 	password = strings.Replace(password, "-", "_", -1)
 
-	for _, stmt := range rotateStatements {
-		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
-			query = strings.TrimSpace(query)
-			if len(query) == 0 {
-				continue
-			}
-
-			m := map[string]string{
-				"username":     m.Username,
-				"old_password": old_password,
-				"password":     password,
-			}
-			log.Printf("Executing query '%s'", query)
-			if err := dbtxn.ExecuteDBQuery(ctx, db, m, query); err != nil {
-				return nil, err
-			}
-		}
-	}
-
-	if err := db.Close(); err != nil {
+	if err := m.changePassword(ctx, password, statements); err != nil {
 		return nil, err
 	}
 
@@ -322,6 +618,58 @@ func (m *SYBASE) RotateRootCredentials(ctx context.Context, statements []string)
 	return m.RawConfig, nil
 }
 
+// changePassword sets the configured login's password with the given
+// statements, or the default statements for the server's dialect.
+func (m *SYBASE) changePassword(ctx context.Context, password string, statements []string) error {
+	caps, err := m.Capabilities(ctx)
+	if err != nil {
+		return err
+	}
+	statements = rotateStatementsOrDefault(statements, caps)
+
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	sess, err := newSession(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	vars := templateVarsFor(m.TemplateVars, map[string]interface{}{
+		"username":     m.Username,
+		"old_password": m.Password,
+		"password":     password,
+	})
+
+	for _, stmt := range statements {
+		log.Printf("Executing statement '%s'", stmt)
+		if err := sess.execStatements(ctx, []string{stmt}, vars); err != nil {
+			sess.close(ctx)
+			return err
+		}
+	}
+	sess.close(ctx)
+
+	// The pool still holds connections authenticated with the old password,
+	// so close them all.
+	return db.Close()
+}
+
+// rotateStatementsOrDefault returns the default rotation statement for the
+// server's dialect if no statements were given.
+func rotateStatementsOrDefault(statements []string, caps *Capabilities) []string {
+	switch {
+	case len(statements) > 0:
+		return statements
+	case caps.modern():
+		return []string{rotateRootCredentialsSQL}
+	default:
+		return []string{rotateRootCredentialsLegacySQL}
+	}
+}
+
 const dropUserSQL = `
 IF EXISTS
   (SELECT name
@@ -332,6 +680,8 @@ BEGIN
 END
 `
 
+const dropAliasSQL = `execute %s.dbo.sp_dropalias %s`
+
 const dropLoginSQL = `
 IF EXISTS
   (SELECT name
@@ -342,6 +692,20 @@ BEGIN
 END
 `
 
+const dropLoginLegacySQL = `
+IF EXISTS
+  (SELECT name
+   FROM master.dbo.syslogins
+   WHERE name = '%s')
+BEGIN
+  execute master.dbo.sp_droplogin %s
+END
+`
+
 const rotateRootCredentialsSQL = `
 ALTER LOGIN {{username}} WITH PASSWORD {{old_password}} MODIFY PASSWORD IMMEDIATELY {{password}}
 `
+
+const rotateRootCredentialsLegacySQL = `
+sp_password {{old_password}}, {{password}}
+`
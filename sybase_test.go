@@ -95,6 +95,56 @@ func TestSYBASE_CreateUser(t *testing.T) {
 	}
 }
 
+func TestSYBASE_CreateUser_RestoresDatabase(t *testing.T) {
+	if os.Getenv("SYBASE_URL") == "" || os.Getenv("VAULT_ACC") != "1" {
+		return
+	}
+	connURL := os.Getenv("SYBASE_URL")
+
+	// A single pooled connection guarantees the check below runs on the
+	// connection used by CreateUser
+	connectionDetails := map[string]interface{}{
+		"connection_url":       connURL,
+		"max_open_connections": 1,
+	}
+
+	db := new()
+	_, err := db.Init(context.Background(), connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer db.Close()
+
+	conn, err := db.getConnection(context.Background())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var before string
+	if err := conn.QueryRow("SELECT db_name()").Scan(&before); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	usernameConfig := dbplugin.UsernameConfig{
+		DisplayName: "test",
+		RoleName:    "test",
+	}
+	statements := dbplugin.Statements{
+		Creation: []string{testSYBASERoleBatches},
+	}
+	if _, _, err := db.CreateUser(context.Background(), statements, usernameConfig, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var after string
+	if err := conn.QueryRow("SELECT db_name()").Scan(&after); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if before != after {
+		t.Fatalf("expected database %q after CreateUser, got %q", before, after)
+	}
+}
+
 func TestSYBASE_RotateRootCredentials(t *testing.T) {
 	if os.Getenv("SYBASE_URL") == "" || os.Getenv("VAULT_ACC") != "1" {
 		return
@@ -198,6 +248,45 @@ func TestSYBASE_RevokeUser(t *testing.T) {
 	}
 }
 
+func TestSYBASE_ValidateStatements(t *testing.T) {
+	if os.Getenv("SYBASE_URL") == "" || os.Getenv("VAULT_ACC") != "1" {
+		return
+	}
+	connURL := os.Getenv("SYBASE_URL")
+
+	connectionDetails := map[string]interface{}{
+		"connection_url": connURL,
+	}
+
+	db := new()
+	_, err := db.Init(context.Background(), connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer db.Close()
+
+	report, err := db.ValidateStatements(context.Background(), dbplugin.Statements{
+		Creation:   []string{testSYBASERoleBatches},
+		Revocation: []string{testSYBASEDropBatches},
+	}, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatalf("expected valid statements: %s", err)
+	}
+
+	report, err = db.ValidateStatements(context.Background(), dbplugin.Statements{
+		Creation: []string{"CREAT LOGIN {{name}} WITH PASSWORD {{password}}\ngo\nUSE no_such_database\ngo\n"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(report.Statements) != 2 || report.Statements[0].Error == "" || report.Statements[1].Error == "" {
+		t.Fatalf("expected both statements to fail, got %#v", report.Statements)
+	}
+}
+
 func testCredsExist(t testing.TB, connURL, username, password string) error {
 	// Log in with the new creds
 	// Expect connURL to be host:port:database
@@ -225,3 +314,21 @@ const testSYBASEDrop = `
 sp_dropuser {{name}}
 DROP LOGIN {{name}}
 `
+
+// testSYBASERoleBatches and testSYBASEDropBatches are the role statements
+// above, split into batches with go lines.
+const testSYBASERoleBatches = `
+CREATE LOGIN {{name}} WITH PASSWORD {{password}} default database vault
+go
+USE vault
+go
+sp_adduser [{{name}}]
+go
+`
+
+const testSYBASEDropBatches = `
+sp_dropuser {{name}}
+go
+DROP LOGIN {{name}}
+go
+`
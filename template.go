@@ -0,0 +1,420 @@
+package sybase
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// Statements are Go text/templates. Every variable is available both as a
+// function, so that the historical {{name}} syntax keeps working, and as a
+// key of the template's data, so that it can be used as {{.name}}.
+//
+// The output of every action is escaped according to the T-SQL context it
+// lands in: inside a '...' or "..." literal quotes are doubled, inside a
+// [...] identifier brackets are doubled, and outside of any quotes a value
+// that is not a plain identifier or number is emitted as a "..." literal.
+// Values produced by quote_ident and quote_literal are already complete
+// tokens and are emitted unchanged outside of quotes.
+
+const (
+	escapeBareFunc         = "_sybase_escape_bare"
+	escapeLiteralFunc      = "_sybase_escape_literal"
+	escapeDoubleQuotedFunc = "_sybase_escape_double_quoted"
+	escapeBracketFunc      = "_sybase_escape_bracket"
+	escapeLineCommentFunc  = "_sybase_escape_line_comment"
+	escapeBlockCommentFunc = "_sybase_escape_block_comment"
+)
+
+// templateBuiltins are the helper functions available to every statement.
+// Template variables may not shadow them.
+var templateBuiltins = template.FuncMap{
+	"quote_ident":   quoteIdent,
+	"quote_literal": quoteLiteral,
+	grantAllFunc:    grantAllOutsideCreation,
+
+	escapeBareFunc:         escapeBare,
+	escapeLiteralFunc:      escaper("'"),
+	escapeDoubleQuotedFunc: escaper(`"`),
+	escapeBracketFunc:      escaper("]"),
+	escapeLineCommentFunc:  escapeLineComment,
+	escapeBlockCommentFunc: escapeBlockComment,
+}
+
+// builtinVariables lists the variables that the plugin fills in itself.
+// Operator-defined template_vars may not use these names.
+var builtinVariables = []string{
+	"name",
+	"password",
+	"expiration",
+	"expiration_date",
+	"expiration_unix",
+	"expiration_days",
+	"role_name",
+	"display_name",
+	"username",
+	"old_password",
+}
+
+var (
+	identifierRegex = regexp.MustCompile(`^[A-Za-z_@#][A-Za-z0-9_@#$]*$`)
+	numberRegex     = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+)
+
+// sqlFragment is a value that is already a complete, correctly quoted T-SQL
+// token and must not be escaped again outside of quotes.
+type sqlFragment string
+
+// renderStatement executes the statement template with the given variables.
+// Referencing a variable that is not in vars is an error.
+func renderStatement(tpl string, vars map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := executeStatement(&buf, tpl, vars, templateFuncs(vars)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// renderCreationStatement is renderStatement for creation statements, the
+// only ones in which grant_all can be used. grant_all calls are expanded with
+// the objects returned by list.
+func renderCreationStatement(tpl string, vars map[string]interface{}, list grantAllLister) (string, error) {
+	var buf bytes.Buffer
+	funcs := templateFuncs(vars)
+	funcs[grantAllFunc] = grantAllFor(vars, list, &buf)
+	if err := executeStatement(&buf, tpl, vars, funcs); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// creationRenderer returns a renderStatement for creation statements that
+// expands grant_all calls with the objects returned by list.
+func creationRenderer(list grantAllLister) func(string, map[string]interface{}) (string, error) {
+	return func(tpl string, vars map[string]interface{}) (string, error) {
+		return renderCreationStatement(tpl, vars, list)
+	}
+}
+
+// executeStatement renders the statement template into buf. The template
+// writes its text to buf as it goes, so functions can see what was rendered
+// before them.
+func executeStatement(buf *bytes.Buffer, tpl string, vars map[string]interface{}, funcs template.FuncMap) error {
+	t, err := parseStatement(tpl, funcs)
+	if err != nil {
+		return err
+	}
+
+	if err := t.Execute(buf, vars); err != nil {
+		return errwrap.Wrapf("could not render statement: {{err}}", err)
+	}
+	return nil
+}
+
+// renderValue executes a template that produces a plain value rather than
+// T-SQL, such as a stored procedure parameter, so nothing is escaped.
+func renderValue(tpl string, vars map[string]interface{}) (string, error) {
+	t, err := template.New("value").Funcs(templateFuncs(vars)).Option("missingkey=error").Parse(tpl)
+	if err != nil {
+		return "", errwrap.Wrapf("invalid value template: {{err}}", err)
+	}
+	if len(t.Templates()) > 1 {
+		return "", fmt.Errorf("invalid value template: template definitions are not supported")
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return "", errwrap.Wrapf("could not render value: {{err}}", err)
+	}
+	return buf.String(), nil
+}
+
+// templateFuncs returns the builtin functions plus one function per
+// variable.
+func templateFuncs(vars map[string]interface{}) template.FuncMap {
+	funcs := template.FuncMap{}
+	for k, v := range templateBuiltins {
+		funcs[k] = v
+	}
+	for k, v := range vars {
+		funcs[k] = variable(v)
+	}
+	return funcs
+}
+
+// parseStatement parses the statement template, with only the given
+// functions defined, and adds the escaping functions to every action.
+func parseStatement(tpl string, funcs template.FuncMap) (*template.Template, error) {
+	t, err := template.New("statement").Funcs(funcs).Option("missingkey=error").Parse(tpl)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid statement template: {{err}}", err)
+	}
+
+	if len(t.Templates()) > 1 {
+		return nil, fmt.Errorf("invalid statement template: template definitions are not supported")
+	}
+	if t.Tree == nil {
+		return t, nil
+	}
+
+	if _, err := escapeList(t.Tree.Root, contextBare); err != nil {
+		return nil, errwrap.Wrapf("invalid statement template: {{err}}", err)
+	}
+	return t, nil
+}
+
+// validateTemplateVars checks that operator-defined template variables can
+// be used from a statement without clashing with the plugin's own.
+func validateTemplateVars(vars map[string]interface{}) error {
+	for k := range vars {
+		if !identifierRegex.MatchString(k) || strings.ContainsAny(k, "@#$") {
+			return fmt.Errorf("invalid template_vars name %q", k)
+		}
+		if _, ok := templateBuiltins[k]; ok {
+			return fmt.Errorf("template_vars name %q is reserved", k)
+		}
+		for _, b := range builtinVariables {
+			if k == b {
+				return fmt.Errorf("template_vars name %q is reserved", k)
+			}
+		}
+	}
+	return nil
+}
+
+// expirationVars returns the expiration variables in the formats supported
+// by the statement templates.
+func expirationVars(expiration time.Time, expirationStr string) map[string]interface{} {
+	days := int(math.Ceil(time.Until(expiration).Hours() / 24))
+	// A password expiration of 0 days means the password never expires
+	if days < 1 {
+		days = 1
+	}
+
+	return map[string]interface{}{
+		"expiration":      expirationStr,
+		"expiration_date": expiration.Format("2006-01-02"),
+		"expiration_unix": expiration.Unix(),
+		"expiration_days": days,
+	}
+}
+
+// templateVarsFor merges the operator-defined template variables with the
+// plugin's own. The plugin's variables win, although validateTemplateVars
+// prevents clashes in the first place.
+func templateVarsFor(custom map[string]interface{}, builtin ...map[string]interface{}) map[string]interface{} {
+	vars := make(map[string]interface{}, len(custom))
+	for k, v := range custom {
+		vars[k] = v
+	}
+	for _, b := range builtin {
+		for k, v := range b {
+			vars[k] = v
+		}
+	}
+	return vars
+}
+
+func variable(v interface{}) func() interface{} {
+	return func() interface{} {
+		return v
+	}
+}
+
+func quoteIdent(v interface{}) sqlFragment {
+	return sqlFragment("[" + strings.Replace(toString(v), "]", "]]", -1) + "]")
+}
+
+func quoteLiteral(v interface{}) sqlFragment {
+	return sqlFragment("'" + strings.Replace(toString(v), "'", "''", -1) + "'")
+}
+
+func escapeBare(v interface{}) string {
+	if f, ok := v.(sqlFragment); ok {
+		return string(f)
+	}
+
+	s := toString(v)
+	if identifierRegex.MatchString(s) || numberRegex.MatchString(s) {
+		return s
+	}
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+func escaper(closing string) func(interface{}) string {
+	return func(v interface{}) string {
+		return strings.Replace(toString(v), closing, closing+closing, -1)
+	}
+}
+
+func escapeLineComment(v interface{}) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(toString(v))
+}
+
+func escapeBlockComment(v interface{}) string {
+	return strings.Replace(toString(v), "*/", "* /", -1)
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case sqlFragment:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// sqlContext is the lexical T-SQL context at a point in a statement.
+type sqlContext int
+
+const (
+	contextBare sqlContext = iota
+	contextLiteral
+	contextDoubleQuoted
+	contextBracket
+	contextLineComment
+	contextBlockComment
+)
+
+func (c sqlContext) escapeFunc() string {
+	switch c {
+	case contextLiteral:
+		return escapeLiteralFunc
+	case contextDoubleQuoted:
+		return escapeDoubleQuotedFunc
+	case contextBracket:
+		return escapeBracketFunc
+	case contextLineComment:
+		return escapeLineCommentFunc
+	case contextBlockComment:
+		return escapeBlockCommentFunc
+	default:
+		return escapeBareFunc
+	}
+}
+
+// closing returns the character that ends a quoted context.
+func (c sqlContext) closing() byte {
+	switch c {
+	case contextLiteral:
+		return '\''
+	case contextDoubleQuoted:
+		return '"'
+	default:
+		return ']'
+	}
+}
+
+// advance returns the context in effect after text.
+func (c sqlContext) advance(text string) sqlContext {
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		switch c {
+		case contextBare:
+			switch {
+			case ch == '\'':
+				c = contextLiteral
+			case ch == '"':
+				c = contextDoubleQuoted
+			case ch == '[':
+				c = contextBracket
+			case strings.HasPrefix(text[i:], "--"):
+				c = contextLineComment
+				i++
+			case strings.HasPrefix(text[i:], "/*"):
+				c = contextBlockComment
+				i++
+			}
+		case contextLiteral, contextDoubleQuoted, contextBracket:
+			closing := c.closing()
+			if ch != closing {
+				continue
+			}
+			if i+1 < len(text) && text[i+1] == closing {
+				i++
+				continue
+			}
+			c = contextBare
+		case contextLineComment:
+			if ch == '\n' {
+				c = contextBare
+			}
+		case contextBlockComment:
+			if strings.HasPrefix(text[i:], "*/") {
+				c = contextBare
+				i++
+			}
+		}
+	}
+	return c
+}
+
+// escapeList adds the escaping function for the current context to every
+// action in list, and returns the context in effect at its end.
+func escapeList(list *parse.ListNode, c sqlContext) (sqlContext, error) {
+	if list == nil {
+		return c, nil
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			c = c.advance(string(n.Text))
+		case *parse.ActionNode:
+			// Declarations and assignments produce no output
+			if len(n.Pipe.Decl) > 0 {
+				continue
+			}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Args:     []parse.Node{parse.NewIdentifier(c.escapeFunc()).SetTree(nil).SetPos(n.Pos)},
+			})
+		case *parse.IfNode:
+			var err error
+			if c, err = escapeBranch(&n.BranchNode, c, false); err != nil {
+				return c, err
+			}
+		case *parse.WithNode:
+			var err error
+			if c, err = escapeBranch(&n.BranchNode, c, false); err != nil {
+				return c, err
+			}
+		case *parse.RangeNode:
+			var err error
+			if c, err = escapeBranch(&n.BranchNode, c, true); err != nil {
+				return c, err
+			}
+		case *parse.TemplateNode:
+			return c, fmt.Errorf("template invocations are not supported")
+		}
+	}
+	return c, nil
+}
+
+func escapeBranch(n *parse.BranchNode, c sqlContext, loop bool) (sqlContext, error) {
+	after, err := escapeList(n.List, c)
+	if err != nil {
+		return c, err
+	}
+	if loop && after != c {
+		return c, fmt.Errorf("loop body must end in the quoting context it starts in")
+	}
+
+	elseAfter, err := escapeList(n.ElseList, c)
+	if err != nil {
+		return c, err
+	}
+	if after != elseAfter {
+		return c, fmt.Errorf("branches must end in the same quoting context")
+	}
+	return after, nil
+}
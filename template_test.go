@@ -0,0 +1,135 @@
+package sybase
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderStatement(t *testing.T) {
+	vars := map[string]interface{}{
+		"name":      "v_test_abc",
+		"password":  "A1a_secret",
+		"odd":       "it's] \"odd\"",
+		"databases": []interface{}{"vault", "reporting"},
+		"empty":     "",
+	}
+
+	tests := map[string]struct {
+		tpl      string
+		expected string
+	}{
+		"legacy syntax": {
+			tpl:      "CREATE LOGIN {{name}} WITH PASSWORD {{password}}",
+			expected: "CREATE LOGIN v_test_abc WITH PASSWORD A1a_secret",
+		},
+		"dot syntax": {
+			tpl:      "sp_adduser {{.name}}",
+			expected: "sp_adduser v_test_abc",
+		},
+		"bare non identifier": {
+			tpl:      "sp_modifylogin {{name}}, fullname, {{odd}}",
+			expected: `sp_modifylogin v_test_abc, fullname, "it's] ""odd"""`,
+		},
+		"single quoted": {
+			tpl:      "select '{{odd}}'",
+			expected: `select 'it''s] "odd"'`,
+		},
+		"double quoted": {
+			tpl:      `select "{{odd}}"`,
+			expected: `select "it's] ""odd"""`,
+		},
+		"bracketed": {
+			tpl:      "sp_adduser [{{odd}}]",
+			expected: `sp_adduser [it's]] "odd"]`,
+		},
+		"quote_ident": {
+			tpl:      "sp_adduser {{quote_ident odd}}",
+			expected: `sp_adduser [it's]] "odd"]`,
+		},
+		"quote_literal": {
+			tpl:      "select {{quote_literal odd}}",
+			expected: `select 'it''s] "odd"'`,
+		},
+		"line comment": {
+			tpl:      "-- {{name}}\nselect 1",
+			expected: "-- v_test_abc\nselect 1",
+		},
+		"conditional": {
+			tpl:      "{{if empty}}select 1{{else}}select 2{{end}}",
+			expected: "select 2",
+		},
+		"loop": {
+			tpl:      "{{range $db := databases}}USE {{$db}}\ngo\nsp_adduser '{{name}}'\ngo\n{{end}}",
+			expected: "USE vault\ngo\nsp_adduser 'v_test_abc'\ngo\nUSE reporting\ngo\nsp_adduser 'v_test_abc'\ngo\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := renderStatement(test.tpl, vars)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if actual != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRenderStatement_Errors(t *testing.T) {
+	vars := map[string]interface{}{
+		"name": "v_test_abc",
+	}
+
+	tests := map[string]string{
+		"undefined function":  "sp_adduser {{password}}",
+		"undefined key":       "sp_adduser {{.password}}",
+		"mismatched branches": "{{if name}}'{{end}}select 1",
+		"unbalanced loop":     "{{range name}}'{{end}}",
+		"definitions":         `{{define "x"}}select 1{{end}}`,
+	}
+
+	for name, tpl := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := renderStatement(tpl, vars); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestValidateTemplateVars(t *testing.T) {
+	if err := validateTemplateVars(map[string]interface{}{"tenant": "acme"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, name := range []string{"name", "quote_ident", "bad-name", "with$dollar"} {
+		if err := validateTemplateVars(map[string]interface{}{name: "x"}); err == nil {
+			t.Fatalf("expected error for %q", name)
+		}
+	}
+}
+
+func TestExpirationVars(t *testing.T) {
+	expiration := time.Now().Add(36 * time.Hour)
+	vars := expirationVars(expiration, "formatted")
+
+	if vars["expiration"] != "formatted" {
+		t.Fatalf("unexpected expiration: %v", vars["expiration"])
+	}
+	if vars["expiration_days"] != 2 {
+		t.Fatalf("expected 2 days, got %v", vars["expiration_days"])
+	}
+	if vars["expiration_unix"] != expiration.Unix() {
+		t.Fatalf("unexpected expiration_unix: %v", vars["expiration_unix"])
+	}
+	if !strings.HasPrefix(expiration.Format(time.RFC3339), vars["expiration_date"].(string)) {
+		t.Fatalf("unexpected expiration_date: %v", vars["expiration_date"])
+	}
+
+	if days := expirationVars(time.Now().Add(-time.Hour), "")["expiration_days"]; days != 1 {
+		t.Fatalf("expected at least 1 day, got %v", days)
+	}
+}
@@ -0,0 +1,301 @@
+package sybase
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
+)
+
+// Placeholder values used to render statements for validation. They are
+// valid identifiers so that they render the same way real values would.
+const (
+	placeholderName        = "v_validate_placeholder"
+	placeholderPassword    = "A1a_Placeholder0000"
+	placeholderRoleName    = "validate"
+	placeholderDisplayName = "validate"
+	placeholderObject      = "grant_all_placeholder"
+)
+
+var useRegex = regexp.MustCompile(`(?is)^use\s+(\[[^\]]+\]|"[^"]+"|[A-Za-z_@#][A-Za-z0-9_@#$]*)\s*$`)
+
+// StatementReport is the outcome of validating a single batch.
+type StatementReport struct {
+	Operation string `json:"operation"`
+	Statement string `json:"statement"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ValidationReport is the outcome of validating a set of statements.
+type ValidationReport struct {
+	Statements []StatementReport `json:"statements"`
+}
+
+// Failed reports whether any statement failed validation.
+func (r *ValidationReport) Failed() bool {
+	for _, s := range r.Statements {
+		if s.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Err summarizes the failed statements as an error, or returns nil if all of
+// them are valid.
+func (r *ValidationReport) Err() error {
+	var failures []string
+	for _, s := range r.Statements {
+		if s.Error != "" {
+			failures = append(failures, fmt.Sprintf("%s statement %q: %s", s.Operation, s.Statement, s.Error))
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d statement(s) failed validation:\n%s", len(failures), strings.Join(failures, "\n"))
+}
+
+func (r *ValidationReport) add(operation, statement string, err error) {
+	report := StatementReport{
+		Operation: operation,
+		Statement: statement,
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	r.Statements = append(r.Statements, report)
+}
+
+// validationStatements are the statements that can be validated at Init.
+type validationStatements struct {
+	Creation   []string `json:"creation" mapstructure:"creation" structs:"creation"`
+	Renewal    []string `json:"renewal" mapstructure:"renewal" structs:"renewal"`
+	Revocation []string `json:"revocation" mapstructure:"revocation" structs:"revocation"`
+	Rotation   []string `json:"rotation" mapstructure:"rotation" structs:"rotation"`
+}
+
+func (v validationStatements) empty() bool {
+	return len(v.Creation)+len(v.Renewal)+len(v.Revocation)+len(v.Rotation) == 0
+}
+
+// ValidateStatements renders the role and rotation statements with
+// placeholder values and sends them to the server without executing them.
+// Each batch is first parsed under "set parseonly on" and then compiled under
+// "set noexec on". USE batches are executed for real, after checking that the
+// database exists, so that later batches are compiled in the right database.
+// Template errors and per-batch server errors are recorded in the report;
+// the returned error is only set if validation itself could not run.
+func (m *SYBASE) ValidateStatements(ctx context.Context, statements dbplugin.Statements, rotation []string) (*ValidationReport, error) {
+	statements = dbutil.StatementCompatibilityHelper(statements)
+
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vars, err := m.placeholderVars()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ValidationReport{}
+
+	role, creation, err := parseRoleDocument(statements)
+	if err != nil {
+		report.add("creation", "role document", err)
+		return report, nil
+	}
+	statements.Creation = creation
+
+	for _, op := range []struct {
+		name string
+		call *procedureCall
+		vars map[string]interface{}
+	}{
+		{"creation", role.Procedures.Create, vars.creation},
+		{"renewal", role.Procedures.Renew, vars.renewal},
+		{"revocation", role.Procedures.Revoke, vars.revocation},
+	} {
+		if op.call != nil {
+			report.add(op.name, "execute "+op.call.Name, m.validateProcedure(ctx, db, op.call, op.vars))
+		}
+	}
+	if role.ExecuteAs != "" {
+		report.add("creation", "set proxy "+role.ExecuteAs, m.checkExecuteAs(ctx, db, role.ExecuteAs))
+	}
+	if role.LoginProfile != "" {
+		report.add("creation", "login profile "+role.LoginProfile, checkLoginProfile(ctx, db, role.LoginProfile))
+	}
+	for _, r := range role.DefaultRoles {
+		report.add("creation", "default role "+r, checkRole(ctx, db, r))
+	}
+	if role.ExecClass != "" {
+		report.add("creation", "bind execution class "+role.ExecClass, checkExecClass(ctx, db, role.ExecClass))
+	}
+	if role.TempdbGroup != "" {
+		report.add("creation", "bind tempdb group "+role.TempdbGroup, checkTempdbGroup(ctx, db, role.TempdbGroup))
+	}
+	for _, op := range []struct {
+		name       string
+		statements []string
+		vars       map[string]interface{}
+	}{
+		{"creation", statements.Creation, vars.creation},
+		{"renewal", statements.Renewal, vars.renewal},
+		{"revocation", statements.Revocation, vars.revocation},
+		{"rotation", rotation, vars.rotation},
+	} {
+		if err := m.validateOperation(ctx, db, report, op.name, op.statements, op.vars); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// operationVars holds the template variables of each kind of statement.
+type operationVars struct {
+	creation   map[string]interface{}
+	renewal    map[string]interface{}
+	revocation map[string]interface{}
+	rotation   map[string]interface{}
+}
+
+// placeholderVars returns template variables filled with placeholder values,
+// for rendering statements that are not going to be executed.
+func (m *SYBASE) placeholderVars() (*operationVars, error) {
+	expiration := time.Now().Add(time.Hour)
+	expirationStr, err := m.GenerateExpiration(expiration)
+	if err != nil {
+		return nil, err
+	}
+
+	userVars := map[string]interface{}{
+		"name": placeholderName,
+	}
+	return &operationVars{
+		creation: templateVarsFor(m.TemplateVars, userVars, map[string]interface{}{
+			"password":     placeholderPassword,
+			"role_name":    placeholderRoleName,
+			"display_name": placeholderDisplayName,
+		}, expirationVars(expiration, expirationStr)),
+		renewal:    templateVarsFor(m.TemplateVars, userVars, expirationVars(expiration, expirationStr)),
+		revocation: templateVarsFor(m.TemplateVars, userVars),
+		rotation: templateVarsFor(m.TemplateVars, map[string]interface{}{
+			"username":     m.Username,
+			"old_password": placeholderPassword,
+			"password":     placeholderPassword,
+		}),
+	}, nil
+}
+
+func (m *SYBASE) validateOperation(ctx context.Context, db *sql.DB, report *ValidationReport, operation string, statements []string, vars map[string]interface{}) error {
+	if len(statements) == 0 {
+		return nil
+	}
+
+	// Every operation runs on its own session, as it would for real
+	sess, err := newSession(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer sess.close(ctx)
+
+	render := renderStatement
+	if operation == "creation" {
+		render = creationRenderer(sess.grantAllObjects(ctx))
+	}
+
+	for _, stmt := range statements {
+		rendered, err := render(stmt, vars)
+		if err != nil {
+			report.add(operation, stmt, err)
+			continue
+		}
+
+		for _, query := range splitStatements(rendered) {
+			sess.trackOptions(query)
+			report.add(operation, query, sess.validateQuery(ctx, query))
+			if sess.discarded {
+				return fmt.Errorf("connection was discarded while validating %s statements", operation)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateQuery checks a single batch without executing it.
+func (s *session) validateQuery(ctx context.Context, query string) error {
+	if match := useRegex.FindStringSubmatch(query); match != nil {
+		database := strings.Trim(match[1], `[]"`)
+
+		var exists int
+		if err := s.conn.QueryRowContext(ctx, fmt.Sprintf(databaseExistsSQL, quoteLiteral(database))).Scan(&exists); err != nil {
+			return errwrap.Wrapf("could not check database: {{err}}", err)
+		}
+		if exists == 0 {
+			return fmt.Errorf("database %q does not exist", database)
+		}
+		return s.execQuery(ctx, query)
+	}
+
+	for _, option := range []string{"parseonly", "noexec"} {
+		if err := s.execQuery(ctx, fmt.Sprintf("set %s on", option)); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("could not enable %s: {{err}}", option), err)
+		}
+
+		err := s.execQuery(ctx, query)
+
+		// A connection left in parseonly or noexec mode would silently
+		// ignore every later statement, so never return it to the pool.
+		if offErr := s.execQuery(ctx, fmt.Sprintf("set %s off", option)); offErr != nil {
+			s.discard()
+			return errwrap.Wrapf(fmt.Sprintf("could not disable %s: {{err}}", option), offErr)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateProcedure checks that the procedure exists and that its parameter
+// values render and convert to their types.
+func (m *SYBASE) validateProcedure(ctx context.Context, db *sql.DB, call *procedureCall, vars map[string]interface{}) error {
+	if _, err := call.args(vars); err != nil {
+		return err
+	}
+
+	var id int
+	if err := db.QueryRowContext(ctx, fmt.Sprintf(procedureExistsSQL, quoteLiteral(call.Name))).Scan(&id); err != nil {
+		return errwrap.Wrapf("could not check procedure: {{err}}", newServerError(err))
+	}
+	if id == 0 {
+		return fmt.Errorf("procedure %q does not exist", call.Name)
+	}
+	return nil
+}
+
+// checkExecuteAs checks that the configured login can execute as the login.
+func (m *SYBASE) checkExecuteAs(ctx context.Context, db *sql.DB, login string) error {
+	sess, err := m.newRoleSession(ctx, db, login)
+	if err != nil {
+		return err
+	}
+	sess.close(ctx)
+	return nil
+}
+
+const procedureExistsSQL = `SELECT isnull(object_id(%s), 0)`
+
+const databaseExistsSQL = `SELECT count(*) FROM master.dbo.sysdatabases WHERE name = %s`